@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kolide/updater/tuf"
+	"github.com/pkg/errors"
+)
+
+func runBackups(args []string) error {
+	fs := flag.NewFlagSet("backups", flag.ExitOnError)
+	var (
+		flRepo     = fs.String("repo", "", "path to the local TUF repository")
+		flValidate = fs.String("validate", "", "validate the backup with this tag")
+		flRestore  = fs.String("restore", "", "validate and restore the backup with this tag")
+	)
+	fs.Parse(args)
+	if *flRepo == "" {
+		return errors.New("-repo is required")
+	}
+
+	switch {
+	case *flRestore != "":
+		if err := tuf.RestoreBackup(*flRepo, *flRestore); err != nil {
+			return errors.Wrap(err, "restoring backup")
+		}
+		fmt.Printf("restored backup %s\n", *flRestore)
+	case *flValidate != "":
+		if err := tuf.ValidateBackup(*flRepo, *flValidate); err != nil {
+			return errors.Wrap(err, "validating backup")
+		}
+		fmt.Printf("backup %s is valid\n", *flValidate)
+	default:
+		backups, err := tuf.ListBackups(*flRepo)
+		if err != nil {
+			return errors.Wrap(err, "listing backups")
+		}
+		if len(backups) == 0 {
+			fmt.Println("no backups found")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		defer w.Flush()
+		for _, backup := range backups {
+			fmt.Fprintf(w, "%s\tcreated %s\n", backup.Tag, backup.Created.Format(time.RFC3339))
+			printRoles(w, backup.Roles)
+		}
+	}
+	return nil
+}
+
+func printRoles(w *tabwriter.Writer, roles []tuf.RoleInfo) {
+	for _, info := range roles {
+		if info.Version == 0 {
+			fmt.Fprintf(w, "  %s\tunreadable\t\n", info.Role)
+			continue
+		}
+		fmt.Fprintf(w, "  %s\tversion %d\texpires %s\n", info.Role, info.Version, info.Expires.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func runExportBundle(args []string) error {
+	fs := flag.NewFlagSet("export-bundle", flag.ExitOnError)
+	var (
+		flags     = addClientFlags(fs)
+		flOut     = fs.String("o", "bundle.tar.gz", "file to write the bundle to")
+		flTargets = fs.String("targets", "", "comma separated list of targets to include, all targets if empty")
+	)
+	fs.Parse(args)
+
+	client, err := flags.newClient()
+	if err != nil {
+		return errors.Wrap(err, "creating client")
+	}
+	defer client.Stop()
+
+	var targets []string
+	if *flTargets != "" {
+		targets = strings.Split(*flTargets, ",")
+	}
+	f, err := os.Create(*flOut)
+	if err != nil {
+		return errors.Wrap(err, "creating bundle file")
+	}
+	if err := client.ExportBundle(f, targets...); err != nil {
+		f.Close()
+		os.Remove(*flOut)
+		return errors.Wrap(err, "exporting bundle")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "writing bundle file")
+	}
+	fmt.Printf("wrote bundle to %s\n", *flOut)
+	return nil
+}
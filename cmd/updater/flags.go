@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"net/url"
+
+	"github.com/kolide/updater/tuf"
+)
+
+// clientFlags are the flags shared by commands that talk to Notary and the
+// mirror.
+type clientFlags struct {
+	repo     *string
+	notary   *string
+	mirror   *string
+	gun      *string
+	caBundle *string
+}
+
+func addClientFlags(fs *flag.FlagSet) *clientFlags {
+	return &clientFlags{
+		repo:     fs.String("repo", "", "path to the local TUF repository"),
+		notary:   fs.String("notary", "", "URL of the notary server"),
+		mirror:   fs.String("mirror", "", "URL of the mirror"),
+		gun:      fs.String("gun", "", "the globally unique identifier"),
+		caBundle: fs.String("ca-bundle", "", "verify notary and mirror certificates with this PEM file"),
+	}
+}
+
+func (f *clientFlags) settings() *tuf.Settings {
+	return &tuf.Settings{
+		LocalRepoPath: *f.repo,
+		NotaryURL:     *f.notary,
+		MirrorURL:     *f.mirror,
+		GUN:           *f.gun,
+	}
+}
+
+// options allows file URLs only when the operator passed one explicitly.
+func (f *clientFlags) options() []tuf.Option {
+	var opts []tuf.Option
+	if isFileURL(*f.notary) || isFileURL(*f.mirror) {
+		opts = append(opts, tuf.WithFileURLs())
+	}
+	if *f.caBundle != "" {
+		opts = append(opts, tuf.WithCABundle(*f.caBundle))
+	}
+	return opts
+}
+
+func isFileURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && u.Scheme == "file"
+}
+
+func (f *clientFlags) newClient() (*tuf.Client, error) {
+	return tuf.NewClient(f.settings(), f.options()...)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/kolide/updater/tuf"
+	"github.com/pkg/errors"
+)
+
+func runInit(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	var (
+		flags        = addClientFlags(fs)
+		flRootSHA256 = fs.String("root-sha256", "", "hex encoded SHA-256 digest of the trusted root.json")
+	)
+	fs.Parse(args)
+	if *flags.repo == "" {
+		return errors.New("-repo is required")
+	}
+	if *flRootSHA256 == "" {
+		return errors.New("-root-sha256 is required")
+	}
+	if err := tuf.Bootstrap(flags.settings(), *flRootSHA256, flags.options()...); err != nil {
+		return errors.Wrap(err, "initializing local repository")
+	}
+	fmt.Printf("initialized %s\n", *flags.repo)
+	return nil
+}
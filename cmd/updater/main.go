@@ -0,0 +1,57 @@
+// Command updater inspects and maintains the local TUF repository used by
+// the updater library.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"backups":       {"list, validate or restore local repository backups", runBackups},
+	"download":      {"download and verify a target", runDownload},
+	"export-bundle": {"export an offline update bundle from a live repository", runExportBundle},
+	"init":          {"create a local repository from a root with a known digest", runInit},
+	"list-targets":  {"list the targets in the trusted metadata", runListTargets},
+	"status":        {"show versions and expiration dates of the trusted roles", runStatus},
+	"update":        {"update the local repository from notary", runUpdate},
+	"verify":        {"check that a file matches the trusted metadata for a target", runVerify},
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags]\n\ncommands:\n", os.Args[0])
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", name, commands[name].usage)
+	}
+}
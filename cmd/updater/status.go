@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kolide/updater/tuf"
+	"github.com/pkg/errors"
+)
+
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	flRepo := fs.String("repo", "", "path to the local TUF repository")
+	fs.Parse(args)
+	if *flRepo == "" {
+		return errors.New("-repo is required")
+	}
+
+	roles, err := tuf.TrustedRoles(*flRepo)
+	if err != nil {
+		return errors.Wrap(err, "reading trusted roles")
+	}
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+	for _, info := range roles {
+		state := "valid"
+		if now.After(info.Expires) {
+			state = "expired"
+		}
+		fmt.Fprintf(w, "%s\tversion %d\texpires %s\t%s\n", info.Role, info.Version, info.Expires.Format(time.RFC3339), state)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/kolide/updater/tuf"
+	"github.com/pkg/errors"
+)
+
+func runListTargets(args []string) error {
+	fs := flag.NewFlagSet("list-targets", flag.ExitOnError)
+	var (
+		flags    = addClientFlags(fs)
+		flUpdate = fs.Bool("update", false, "update the local repository before listing targets")
+	)
+	fs.Parse(args)
+
+	client, err := flags.newClient()
+	if err != nil {
+		return errors.Wrap(err, "creating client")
+	}
+	defer client.Stop()
+	if *flUpdate {
+		if _, _, err := client.Update(); err != nil {
+			return errors.Wrap(err, "updating")
+		}
+	}
+	targets, err := client.Targets()
+	if err != nil {
+		return errors.Wrap(err, "listing targets")
+	}
+	var names []string
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+	for _, name := range names {
+		fim := targets[name]
+		fmt.Fprintf(w, "%s\t%d bytes\tsha256 %s\n", name, fim.Length, hexDigest(fim.Hashes["sha256"]))
+	}
+	return nil
+}
+
+// hexDigest converts a base64 encoded hash from TUF metadata into the hex form
+// printed by tools like sha256sum.
+func hexDigest(encoded string) string {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) == 0 {
+		return "-"
+	}
+	return hex.EncodeToString(raw)
+}
+
+func runDownload(args []string) error {
+	fs := flag.NewFlagSet("download", flag.ExitOnError)
+	var (
+		flags    = addClientFlags(fs)
+		flOut    = fs.String("o", "", "file to write the target to, defaults to the last element of the target name")
+		flUpdate = fs.Bool("update", true, "update the local repository before downloading")
+	)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: download [flags] <target>")
+	}
+	target := fs.Arg(0)
+	out := *flOut
+	if out == "" {
+		out = path.Base(target)
+	}
+
+	client, err := flags.newClient()
+	if err != nil {
+		return errors.Wrap(err, "creating client")
+	}
+	defer client.Stop()
+	if *flUpdate {
+		if _, _, err := client.Update(); err != nil {
+			return errors.Wrap(err, "updating")
+		}
+	}
+	// Open only returns the target once it has been verified, so nothing is
+	// written to out unless it is trusted.
+	rdr, err := client.Open(target)
+	if err != nil {
+		return errors.Wrapf(err, "opening %q", target)
+	}
+	defer rdr.Close()
+	f, err := os.Create(out)
+	if err != nil {
+		return errors.Wrap(err, "creating output file")
+	}
+	if _, err := io.Copy(f, rdr); err != nil {
+		f.Close()
+		os.Remove(out)
+		return errors.Wrapf(err, "downloading %q", target)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "writing output file")
+	}
+	fmt.Printf("downloaded %s to %s\n", target, out)
+	return nil
+}
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var (
+		flRepo   = fs.String("repo", "", "path to the local TUF repository")
+		flTarget = fs.String("target", "", "name of the target the file should match")
+	)
+	fs.Parse(args)
+	if fs.NArg() != 1 || *flRepo == "" || *flTarget == "" {
+		return errors.New("usage: verify -repo <path> -target <target> <file>")
+	}
+
+	// Only the trusted metadata in the local repository is used, so notary
+	// doesn't need to be reachable.
+	if err := tuf.VerifyLocalFile(*flRepo, *flTarget, fs.Arg(0)); err != nil {
+		return errors.Wrap(err, "verifying file")
+	}
+	fmt.Printf("%s matches %s\n", fs.Arg(0), *flTarget)
+	return nil
+}
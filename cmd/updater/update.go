@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+func runUpdate(args []string) error {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	flags := addClientFlags(fs)
+	fs.Parse(args)
+
+	client, err := flags.newClient()
+	if err != nil {
+		return errors.Wrap(err, "creating client")
+	}
+	defer client.Stop()
+	files, latest, err := client.Update()
+	if err != nil {
+		return errors.Wrap(err, "updating")
+	}
+	if latest {
+		fmt.Println("already up to date")
+		return nil
+	}
+	fmt.Printf("updated, %d targets\n", len(files))
+	return nil
+}
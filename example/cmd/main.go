@@ -22,6 +22,7 @@ func main() {
 		flGUN         = flag.String("gun", "kolide/greeter/darwin", "the globally unique identifier")
 		flBootstrap   = flag.Bool("bootstrap", false, "set up local repository for the GUN from the local notary-server")
 		flDownoad     = flag.String("download", "", "download a specific target")
+		flCABundle    = flag.String("ca-bundle", "", "verify notary and mirror certificates with this PEM file instead of skipping verification")
 	)
 	flag.Parse()
 
@@ -72,11 +73,13 @@ func main() {
 
 	StagingPath := filepath.Join(*baseDir, "staging")
 	TargetName := "latest/target"
-	update, err := tuf.NewClient(
-		&settings,
-		tuf.WithAutoUpdate(TargetName, StagingPath, updateHandler),
-		tuf.WithHTTPClient(insecureClient()),
-	)
+	opts := []tuf.Option{tuf.WithAutoUpdate(TargetName, StagingPath, updateHandler)}
+	if *flCABundle != "" {
+		opts = append(opts, tuf.WithCABundle(*flCABundle))
+	} else {
+		opts = append(opts, tuf.WithHTTPClient(insecureClient()))
+	}
+	update, err := tuf.NewClient(&settings, opts...)
 
 	if err != nil {
 		fmt.Printf("could not create updater: %q", err)
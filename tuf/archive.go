@@ -0,0 +1,340 @@
+package tuf
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxExtractedSize limits the total size of the files extracted from an
+// archive.
+const maxExtractedSize = int64(4 << 30)
+
+// manifestCustom is the custom metadata of a file in an archive manifest.
+type manifestCustom struct {
+	EntryPoint bool `json:"entrypoint"`
+}
+
+var (
+	errUnsafeArchive   = errors.New("archive contains an unsafe entry")
+	errArchiveTooLarge = errors.New("archive contents are too large")
+	errManifestMissing = errors.New("archive manifest is missing")
+	errNotInManifest   = errors.New("archive contains a file that is not in the manifest")
+)
+
+var archiveExtensions = []string{".tar.gz", ".tgz", ".tar", ".zip"}
+
+// WithArchiveExtraction treats the autoupdate target as an archive, a tar
+// file which may be gzip compressed, or a zip file. Once the archive has been
+// verified it is extracted into a directory next to it and the
+// NotificationHandler is called with the path of the directory. See
+// Installer.Extract. If manifestName is not empty, it names a file in the
+// archive containing the hashes and lengths of every other file in the
+// archive, in the same format as the targets in TUF metadata, which are
+// verified after extraction. A file in the manifest with the custom metadata
+// {"entrypoint": true} is the entry point of the archive, and is the path
+// given to a HealthCheck, otherwise the HealthCheck is given the path of the
+// extracted directory. ExecHealthCheck requires an entry point.
+func WithArchiveExtraction(manifestName string) Option {
+	return func(c *Client) {
+		c.extractArchive = true
+		c.archiveManifest = manifestName
+	}
+}
+
+// ExtractedPath returns the directory an installed archive is extracted
+// into, which is the path of the archive without its extension.
+func (in *Installer) ExtractedPath(targetName string) string {
+	p := in.Path(targetName)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(p, ext) && len(p) > len(ext) {
+			return strings.TrimSuffix(p, ext)
+		}
+	}
+	return p + ".d"
+}
+
+// Extract unpacks the installed archive for targetName into ExtractedPath.
+// The archive is unpacked into a temporary directory which replaces the
+// previously extracted directory only once every file has been extracted
+// and, if manifestName is not empty, verified against the manifest. Entries
+// that are links, devices, or would be written outside of the directory are
+// rejected. The directory being replaced is kept and is restored by
+// Rollback.
+func (in *Installer) Extract(targetName, manifestName string) (string, error) {
+	dst, _, err := in.extract(targetName, manifestName)
+	return dst, err
+}
+
+// extract is Extract, also returning the path of the entry point named by
+// the manifest, which is empty if there isn't one.
+func (in *Installer) extract(targetName, manifestName string) (dst, entryPoint string, err error) {
+	dst = in.ExtractedPath(targetName)
+	tmp, err := ioutil.TempDir(filepath.Dir(dst), "."+filepath.Base(dst)+".")
+	if err != nil {
+		return "", "", errors.Wrap(err, "creating temporary directory for extraction")
+	}
+	defer os.RemoveAll(tmp)
+	if err := extractArchive(in.Path(targetName), tmp); err != nil {
+		return "", "", err
+	}
+	if manifestName != "" {
+		if entryPoint, err = verifyManifest(tmp, manifestName); err != nil {
+			return "", "", err
+		}
+	}
+	prev := dst + previousSuffix
+	if _, err := os.Stat(dst); err == nil {
+		if err := os.RemoveAll(prev); err != nil {
+			return "", "", errors.Wrap(err, "removing old previous extraction")
+		}
+		if err := os.Rename(dst, prev); err != nil {
+			return "", "", errors.Wrap(err, "saving previous extraction")
+		}
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return "", "", errors.Wrap(err, "moving extracted archive into place")
+	}
+	syncDir(filepath.Dir(dst))
+	if entryPoint != "" {
+		entryPoint = filepath.Join(dst, filepath.FromSlash(entryPoint))
+	}
+	return dst, entryPoint, nil
+}
+
+// rollbackExtracted restores the directory replaced by the last Extract, or
+// removes the extracted directory if there wasn't one.
+func (in *Installer) rollbackExtracted(targetName string) error {
+	dst := in.ExtractedPath(targetName)
+	prev := dst + previousSuffix
+	if err := os.RemoveAll(dst); err != nil {
+		return errors.Wrap(err, "removing extracted archive")
+	}
+	if _, err := os.Stat(prev); os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.Rename(prev, dst); err != nil {
+		return errors.Wrapf(err, "rolling back extracted %q", targetName)
+	}
+	syncDir(filepath.Dir(dst))
+	return nil
+}
+
+// extractArchive detects the format of the archive at archivePath and
+// unpacks it into dir.
+func extractArchive(archivePath, dir string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return errors.Wrap(err, "opening archive")
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		fi, err := f.Stat()
+		if err != nil {
+			return errors.Wrap(err, "reading archive")
+		}
+		return extractZip(f, fi.Size(), dir)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return errors.Wrap(err, "reading compressed archive")
+		}
+		defer gz.Close()
+		return extractTar(gz, dir)
+	default:
+		return extractTar(br, dir)
+	}
+}
+
+func extractTar(rdr io.Reader, dir string) error {
+	tr := tar.NewReader(rdr)
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "reading tar archive")
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := makeArchiveDir(dir, hdr.Name); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			total += hdr.Size
+			if total > maxExtractedSize {
+				return errArchiveTooLarge
+			}
+			if err := writeArchiveFile(dir, hdr.Name, os.FileMode(hdr.Mode), io.LimitReader(tr, hdr.Size)); err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			return errors.Wrapf(errUnsafeArchive, "%q has type %q", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
+
+func extractZip(rdr io.ReaderAt, size int64, dir string) error {
+	zr, err := zip.NewReader(rdr, size)
+	if err != nil {
+		return errors.Wrap(err, "reading zip archive")
+	}
+	var total int64
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		switch {
+		case mode.IsDir():
+			if err := makeArchiveDir(dir, zf.Name); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			total += int64(zf.UncompressedSize64)
+			if total > maxExtractedSize || zf.UncompressedSize64 > uint64(maxExtractedSize) {
+				return errArchiveTooLarge
+			}
+			// The zip reader fails if an entry is larger than its header says,
+			// and checks the CRC once the entry is read to the end.
+			body, err := zf.Open()
+			if err != nil {
+				return errors.Wrapf(err, "reading %q from zip archive", zf.Name)
+			}
+			err = writeArchiveFile(dir, zf.Name, mode, body)
+			body.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return errors.Wrapf(errUnsafeArchive, "%q has mode %s", zf.Name, mode)
+		}
+	}
+	return nil
+}
+
+// archivePath returns the location of an archive entry within dir, refusing
+// names that are absolute or would be outside of dir.
+func archivePath(dir, name string) (string, error) {
+	if strings.Contains(name, `\`) {
+		return "", errors.Wrapf(errUnsafeArchive, "%q", name)
+	}
+	cleaned, err := localFileName(name)
+	if err != nil || cleaned == "." || filepath.IsAbs(cleaned) || filepath.VolumeName(cleaned) != "" {
+		return "", errors.Wrapf(errUnsafeArchive, "%q", name)
+	}
+	return filepath.Join(dir, cleaned), nil
+}
+
+func makeArchiveDir(dir, name string) error {
+	p, err := archivePath(dir, name)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(os.MkdirAll(p, 0755), "creating directory from archive")
+}
+
+func writeArchiveFile(dir, name string, mode os.FileMode, rdr io.Reader) error {
+	p, err := archivePath(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return errors.Wrap(err, "creating directory from archive")
+	}
+	// Only permission bits are kept, never setuid, setgid or sticky bits.
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm()&0755)
+	if err != nil {
+		return errors.Wrapf(err, "extracting %q", name)
+	}
+	if _, err := io.Copy(f, rdr); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "extracting %q", name)
+	}
+	return errors.Wrapf(f.Close(), "extracting %q", name)
+}
+
+// verifyManifest checks every file extracted into dir against the manifest,
+// and that there are no files that aren't in the manifest. It returns the
+// slash separated name of the entry point, if the manifest has one.
+func verifyManifest(dir, manifestName string) (string, error) {
+	manifestPath, err := archivePath(dir, manifestName)
+	if err != nil {
+		return "", err
+	}
+	buff, err := ioutil.ReadFile(manifestPath)
+	if os.IsNotExist(err) {
+		return "", errManifestMissing
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "reading archive manifest")
+	}
+	var listed FimMap
+	if err := json.Unmarshal(buff, &listed); err != nil {
+		return "", errors.Wrap(err, "decoding archive manifest")
+	}
+	// Names are cleaned so that they can be compared with the names of the
+	// extracted files.
+	manifest := make(FimMap)
+	var entryPoint string
+	for name, fim := range listed {
+		cleaned := path.Clean(name)
+		if _, ok := manifest[cleaned]; ok {
+			return "", errors.Errorf("%q is in the manifest more than once", cleaned)
+		}
+		manifest[cleaned] = fim
+		var custom manifestCustom
+		if fim.Custom != nil && json.Unmarshal(*fim.Custom, &custom) == nil && custom.EntryPoint {
+			if entryPoint != "" {
+				return "", errors.New("manifest has more than one entry point")
+			}
+			entryPoint = cleaned
+		}
+	}
+	found := make(map[string]bool)
+	err = filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() || p == manifestPath {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		fim, ok := manifest[name]
+		if !ok {
+			return errors.Wrapf(errNotInManifest, "%q", name)
+		}
+		found[name] = true
+		f, err := os.Open(p)
+		if err != nil {
+			return errors.Wrapf(err, "opening %q", name)
+		}
+		defer f.Close()
+		return errors.Wrapf(fim.verify(io.LimitReader(f, fim.Length+1)), "verifying %q", name)
+	})
+	if err != nil {
+		return "", err
+	}
+	for name := range manifest {
+		if !found[name] {
+			return "", errors.Errorf("%q is in the manifest but not in the archive", name)
+		}
+	}
+	return entryPoint, nil
+}
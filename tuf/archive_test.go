@@ -0,0 +1,234 @@
+package tuf
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	cjson "github.com/docker/go/canonical/json"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type archiveEntryFixture struct {
+	name     string
+	content  string
+	mode     int64
+	typeflag byte
+	linkname string
+}
+
+func testTarGz(t *testing.T, entries []archiveEntryFixture) []byte {
+	var buff bytes.Buffer
+	gz := gzip.NewWriter(&buff)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		typeflag := e.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		hdr := &tar.Header{Name: e.name, Mode: mode, Typeflag: typeflag, Linkname: e.linkname}
+		if typeflag == tar.TypeReg {
+			hdr.Size = int64(len(e.content))
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		if typeflag == tar.TypeReg {
+			_, err := tw.Write([]byte(e.content))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buff.Bytes()
+}
+
+func testManifest(t *testing.T, files map[string]string) string {
+	manifest := make(FimMap)
+	for name, content := range files {
+		manifest[name] = testFIM([]byte(content))
+	}
+	buff, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	return string(buff)
+}
+
+func installArchive(t *testing.T, in *Installer, name string, archive []byte, manifestName string) (string, error) {
+	_, err := in.Install(name, testFIM(archive), writeContent(archive))
+	require.NoError(t, err)
+	return in.Extract(name, manifestName)
+}
+
+func TestExtractArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	in := NewInstaller(dir)
+
+	files := map[string]string{"bin/app": "binary", "etc/app.conf": "config"}
+	archive := testTarGz(t, []archiveEntryFixture{
+		{name: "bin/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "bin/app", content: "binary", mode: 04755},
+		{name: "etc/app.conf", content: "config"},
+		{name: "MANIFEST.json", content: testManifest(t, files)},
+	})
+	extracted, err := installArchive(t, in, "edge/app.tar.gz", archive, "MANIFEST.json")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "edge", "app"), extracted)
+	buff, err := ioutil.ReadFile(filepath.Join(extracted, "bin", "app"))
+	require.NoError(t, err)
+	assert.Equal(t, "binary", string(buff))
+	fi, err := os.Stat(filepath.Join(extracted, "bin", "app"))
+	require.NoError(t, err)
+	// setuid is dropped
+	assert.Equal(t, os.FileMode(0755), fi.Mode())
+
+	// a second version replaces the first, which can be restored
+	archive = testTarGz(t, []archiveEntryFixture{{name: "bin/app", content: "version 2"}})
+	_, err = installArchive(t, in, "edge/app.tar.gz", archive, "")
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(extracted, "etc", "app.conf"))
+	assert.True(t, os.IsNotExist(err))
+	require.NoError(t, in.rollbackExtracted("edge/app.tar.gz"))
+	buff, err = ioutil.ReadFile(filepath.Join(extracted, "bin", "app"))
+	require.NoError(t, err)
+	assert.Equal(t, "binary", string(buff))
+}
+
+func TestExtractZip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var buff bytes.Buffer
+	zw := zip.NewWriter(&buff)
+	w, err := zw.Create("app/run.sh")
+	require.NoError(t, err)
+	w.Write([]byte("#!/bin/sh\n"))
+	require.NoError(t, zw.Close())
+
+	extracted, err := installArchive(t, NewInstaller(dir), "app.zip", buff.Bytes(), "")
+	require.NoError(t, err)
+	content, err := ioutil.ReadFile(filepath.Join(extracted, "app", "run.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\n", string(content))
+
+	// entries are read to the end so that the checksum is verified
+	buff.Reset()
+	zw = zip.NewWriter(&buff)
+	w, err = zw.CreateHeader(&zip.FileHeader{Name: "app/run.sh", Method: zip.Store})
+	require.NoError(t, err)
+	w.Write([]byte("#!/bin/sh\n"))
+	require.NoError(t, zw.Close())
+	corrupt := bytes.Replace(buff.Bytes(), []byte("#!/bin/sh\n"), []byte("#!/bin/zh\n"), 1)
+	_, err = installArchive(t, NewInstaller(dir), "corrupt.zip", corrupt, "")
+	require.Error(t, err)
+	assert.Equal(t, zip.ErrChecksum, errors.Cause(err))
+}
+
+func TestExtractUnsafeArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	in := NewInstaller(filepath.Join(dir, "staging"))
+
+	for _, entry := range []archiveEntryFixture{
+		{name: "../escape", content: "x"},
+		{name: "a/../../escape", content: "x"},
+		{name: "/etc/passwd", content: "x"},
+		{name: `..\escape`, content: "x"},
+		{name: "link", typeflag: tar.TypeSymlink, linkname: "/etc"},
+		{name: "hardlink", typeflag: tar.TypeLink, linkname: "../../etc/passwd"},
+		{name: "fifo", typeflag: tar.TypeFifo},
+	} {
+		_, err := installArchive(t, in, "app.tar.gz", testTarGz(t, []archiveEntryFixture{entry}), "")
+		require.Error(t, err, entry.name)
+		assert.Equal(t, errUnsafeArchive, errors.Cause(err), entry.name)
+		_, err = os.Stat(filepath.Join(dir, "escape"))
+		assert.True(t, os.IsNotExist(err))
+		_, err = os.Stat(in.ExtractedPath("app.tar.gz"))
+		assert.True(t, os.IsNotExist(err))
+	}
+}
+
+func TestExtractManifestMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	in := NewInstaller(dir)
+	manifest := testManifest(t, map[string]string{"app": "expected"})
+
+	for _, tc := range []struct {
+		entries  []archiveEntryFixture
+		expected error
+	}{
+		{[]archiveEntryFixture{{name: "app", content: "EXPECTED"}, {name: "MANIFEST.json", content: manifest}}, errHashIncorrect},
+		{[]archiveEntryFixture{{name: "app", content: "expected"}, {name: "extra", content: "x"}, {name: "MANIFEST.json", content: manifest}}, errNotInManifest},
+		{[]archiveEntryFixture{{name: "app", content: "expected"}}, errManifestMissing},
+	} {
+		_, err := installArchive(t, in, "app.tgz", testTarGz(t, tc.entries), "MANIFEST.json")
+		require.Error(t, err)
+		assert.Equal(t, tc.expected, errors.Cause(err))
+	}
+}
+
+func TestAutoupdateExtraction(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// manifest names are cleaned before they are compared
+	entryPoint := testFIM([]byte("good"))
+	custom := cjson.RawMessage(`{"entrypoint":true}`)
+	entryPoint.Custom = &custom
+	manifest, err := json.Marshal(FimMap{"./bin/app": entryPoint})
+	require.NoError(t, err)
+	good := testTarGz(t, []archiveEntryFixture{{name: "bin/app", content: "good"}, {name: "MANIFEST.json", content: string(manifest)}})
+	bad := testTarGz(t, []archiveEntryFixture{{name: "../app", content: "bad"}})
+	m := &mapMirror{targets: map[string][]byte{"good.tar.gz": good, "bad.tar.gz": bad}}
+	rs := newRepoMan(nil, nil, m, &Settings{}, defaultBackupAge, clock.NewMockClock(testTime))
+	rs.targets = &RootTarget{paths: FimMap{"good.tar.gz": testFIM(good), "bad.tar.gz": testFIM(bad)}}
+	state, err := loadAutoupdateState(dir)
+	require.NoError(t, err)
+	var checked string
+	au := &autoupdater{
+		installer:       NewInstaller(dir),
+		state:           state,
+		extractArchive:  true,
+		archiveManifest: "MANIFEST.json",
+		healthCheck: func(_ context.Context, installedPath string) error {
+			checked = installedPath
+			return nil
+		},
+		logger: log.NewNopLogger(),
+	}
+
+	au.watchedTarget = "good.tar.gz"
+	dpath, err := au.install(rs, testFIM(good))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "good"), dpath)
+	// the health check runs the entry point rather than the directory
+	assert.Equal(t, filepath.Join(dir, "good", "bin", "app"), checked)
+
+	// an archive that can't be extracted is removed
+	au.watchedTarget = "bad.tar.gz"
+	_, err = au.install(rs, testFIM(bad))
+	require.Error(t, err)
+	_, err = os.Stat(filepath.Join(dir, "bad.tar.gz"))
+	assert.True(t, os.IsNotExist(err))
+}
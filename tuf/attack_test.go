@@ -0,0 +1,451 @@
+package tuf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/kolide/updater/tuf/authoring"
+	"github.com/kolide/updater/tuf/tuftest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// attackFixture is a client whose local repository is up to date with an
+// in-process repository that an attacker is about to tamper with.
+type attackFixture struct {
+	server *tuftest.Server
+	client *Client
+	clock  *clock.MockClock
+	local  string
+	// genuine is the content of edge/target
+	genuine []byte
+	done    chan struct{}
+}
+
+// attackScenario mounts an attack against a Client. When download is empty
+// the attack is checked with Update, otherwise the client is updated before
+// the attack and download is the target fetched afterward.
+type attackScenario struct {
+	name     string
+	attack   func(t *testing.T, f *attackFixture)
+	download string
+	expect   func(t *testing.T, err error, downloaded []byte, f *attackFixture)
+}
+
+func setupAttack(t *testing.T) (*attackFixture, func()) {
+	server, err := tuftest.NewServer(testGUN)
+	require.NoError(t, err)
+	// publish a few times so that there are old versions to replay
+	require.NoError(t, server.PublishTarget(authoring.RoleTargets, "edge/target", []byte("version one")))
+	genuine := []byte("version two")
+	require.NoError(t, server.PublishTarget(authoring.RoleTargets, "edge/target", genuine))
+
+	local, err := ioutil.TempDir("", "attack")
+	require.NoError(t, err)
+	require.NoError(t, server.WriteLocalRepo(local))
+	k := clock.NewMockClock(time.Now())
+	settings := &Settings{
+		LocalRepoPath: local,
+		NotaryURL:     server.NotaryURL(),
+		MirrorURL:     server.MirrorURL(),
+		GUN:           testGUN,
+	}
+	client, err := NewClient(settings, WithHTTPClient(server.Client()), withClock(k), loadOnStart(false))
+	require.NoError(t, err)
+	f := &attackFixture{server: server, client: client, clock: k, local: local, genuine: genuine, done: make(chan struct{})}
+	return f, func() {
+		close(f.done)
+		client.Stop()
+		server.Close()
+		os.RemoveAll(local)
+	}
+}
+
+// newClient creates another client for the fixture's local repository and
+// server, with opts added to the options of the fixture's client.
+func (f *attackFixture) newClient(t *testing.T, opts ...Option) *Client {
+	settings := &Settings{
+		LocalRepoPath: f.local,
+		NotaryURL:     f.server.NotaryURL(),
+		MirrorURL:     f.server.MirrorURL(),
+		GUN:           testGUN,
+	}
+	opts = append([]Option{WithHTTPClient(f.server.Client()), withClock(f.clock), loadOnStart(false)}, opts...)
+	client, err := NewClient(settings, opts...)
+	require.NoError(t, err)
+	return client
+}
+
+// trustedState hashes the roles in the local repository, ignoring backups.
+func trustedState(t *testing.T, dir string) map[string][32]byte {
+	state := make(map[string][32]byte)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() || backupMatcher.MatchString(path) {
+			return err
+		}
+		buff, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		state[path] = sha256.Sum256(buff)
+		return nil
+	})
+	require.NoError(t, err)
+	return state
+}
+
+type signable interface {
+	Sign(signers ...*authoring.Signer) error
+}
+
+// forge decodes published metadata into role, lets mutate change it, and
+// signs it with signers, as an attacker holding those keys would.
+func forge(t *testing.T, published []byte, role signable, mutate func(), signers ...*authoring.Signer) []byte {
+	require.NoError(t, json.Unmarshal(published, role))
+	mutate()
+	require.NoError(t, role.Sign(signers...))
+	buff, err := authoring.Marshal(role)
+	require.NoError(t, err)
+	return buff
+}
+
+// forgeTimestamp serves a timestamp, signed with the compromised timestamp
+// key, that points at snapshot.
+func forgeTimestamp(t *testing.T, f *attackFixture, snapshot []byte) {
+	published, _ := f.server.Role(authoring.RoleTimestamp)
+	var timestamp authoring.Timestamp
+	forged := forge(t, published, &timestamp, func() {
+		timestamp.Signed.Version++
+		timestamp.Signed.Meta[authoring.RoleSnapshot] = authoring.NewFileMeta(snapshot)
+	}, f.server.Keys.Timestamp)
+	f.server.SetRoleFault(authoring.RoleTimestamp, tuftest.ReplaceFault(forged))
+}
+
+// forgeSnapshot serves a snapshot, signed with the compromised snapshot and
+// timestamp keys, with changes that mutate makes to its meta.
+func forgeSnapshot(t *testing.T, f *attackFixture, mutate func(meta map[string]authoring.FileMeta)) {
+	published, _ := f.server.Role(authoring.RoleSnapshot)
+	var snapshot authoring.Snapshot
+	forged := forge(t, published, &snapshot, func() {
+		snapshot.Signed.Version++
+		mutate(snapshot.Signed.Meta)
+	}, f.server.Keys.Snapshot)
+	f.server.SetRoleFault(authoring.RoleSnapshot, tuftest.ReplaceFault(forged))
+	forgeTimestamp(t, f, forged)
+}
+
+func expectCause(cause error) func(*testing.T, error, []byte, *attackFixture) {
+	return func(t *testing.T, err error, _ []byte, _ *attackFixture) {
+		require.Error(t, err)
+		assert.Equal(t, cause, errors.Cause(err), err.Error())
+	}
+}
+
+// passTime runs the client's clock at a second every 10ms, so that retrieval
+// deadlines pass without the test waiting for them.
+func passTime(f *attackFixture) {
+	go func() {
+		for {
+			select {
+			case <-f.done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				f.clock.AddTime(time.Second)
+			}
+		}
+	}()
+}
+
+func expectGenuine(t *testing.T, err error, downloaded []byte, f *attackFixture) {
+	require.NoError(t, err)
+	assert.Equal(t, f.genuine, downloaded)
+}
+
+var attackScenarios = []attackScenario{
+	{
+		name: "timestamp rollback",
+		attack: func(t *testing.T, f *attackFixture) {
+			require.NoError(t, f.server.ServeVersion(authoring.RoleTimestamp, 1))
+		},
+		expect: expectCause(errRollbackAttack),
+	},
+	{
+		name: "snapshot rollback with compromised timestamp key",
+		attack: func(t *testing.T, f *attackFixture) {
+			old, ok := f.server.RoleVersion(authoring.RoleSnapshot, 1)
+			require.True(t, ok)
+			f.server.SetRoleFault(authoring.RoleSnapshot, tuftest.ReplaceFault(old))
+			forgeTimestamp(t, f, old)
+		},
+		expect: expectCause(errRollbackAttack),
+	},
+	{
+		name: "snapshot version differs from timestamp",
+		attack: func(t *testing.T, f *attackFixture) {
+			published, _ := f.server.Role(authoring.RoleTimestamp)
+			var timestamp authoring.Timestamp
+			forged := forge(t, published, &timestamp, func() {
+				timestamp.Signed.Version++
+				meta := timestamp.Signed.Meta[authoring.RoleSnapshot]
+				meta.Version++
+				timestamp.Signed.Meta[authoring.RoleSnapshot] = meta
+			}, f.server.Keys.Timestamp)
+			f.server.SetRoleFault(authoring.RoleTimestamp, tuftest.ReplaceFault(forged))
+		},
+		expect: expectCause(errVersionIncorrect),
+	},
+	{
+		name: "targets version differs from snapshot",
+		attack: func(t *testing.T, f *attackFixture) {
+			forgeSnapshot(t, f, func(meta map[string]authoring.FileMeta) {
+				targets := meta[authoring.RoleTargets]
+				targets.Version++
+				meta[authoring.RoleTargets] = targets
+			})
+		},
+		expect: expectCause(errVersionIncorrect),
+	},
+	{
+		name: "targets rollback listed in snapshot",
+		attack: func(t *testing.T, f *attackFixture) {
+			old, ok := f.server.RoleVersion(authoring.RoleTargets, 2)
+			require.True(t, ok)
+			forgeSnapshot(t, f, func(meta map[string]authoring.FileMeta) {
+				rollback := authoring.NewFileMeta(old)
+				rollback.Version = 2
+				meta[authoring.RoleTargets] = rollback
+			})
+			f.server.SetRoleFault(authoring.RoleTargets, tuftest.ReplaceFault(old))
+		},
+		expect: expectCause(errRollbackAttack),
+	},
+	{
+		// Notary doesn't list versions in the snapshot.
+		name: "targets rollback without versions in snapshot",
+		attack: func(t *testing.T, f *attackFixture) {
+			old, ok := f.server.RoleVersion(authoring.RoleTargets, 2)
+			require.True(t, ok)
+			forgeSnapshot(t, f, func(meta map[string]authoring.FileMeta) {
+				for name, fm := range meta {
+					fm.Version = 0
+					meta[name] = fm
+				}
+				meta[authoring.RoleTargets] = authoring.NewFileMeta(old)
+			})
+			f.server.SetRoleFault(authoring.RoleTargets, tuftest.ReplaceFault(old))
+		},
+		expect: expectCause(errRollbackAttack),
+	},
+	{
+		name: "untrusted snapshot with version differing from timestamp",
+		attack: func(t *testing.T, f *attackFixture) {
+			rogue, err := authoring.GenerateSigner()
+			require.NoError(t, err)
+			published, _ := f.server.Role(authoring.RoleSnapshot)
+			var snapshot authoring.Snapshot
+			forged := forge(t, published, &snapshot, func() {
+				snapshot.Signed.Version++
+			}, rogue)
+			f.server.SetRoleFault(authoring.RoleSnapshot, tuftest.ReplaceFault(forged))
+			published, _ = f.server.Role(authoring.RoleTimestamp)
+			var timestamp authoring.Timestamp
+			forgedTimestamp := forge(t, published, &timestamp, func() {
+				timestamp.Signed.Version++
+				meta := authoring.NewFileMeta(forged)
+				meta.Version = snapshot.Signed.Version + 1
+				timestamp.Signed.Meta[authoring.RoleSnapshot] = meta
+			}, f.server.Keys.Timestamp)
+			f.server.SetRoleFault(authoring.RoleTimestamp, tuftest.ReplaceFault(forgedTimestamp))
+		},
+		expect: expectCause(errSignatureThresholdNotMet),
+	},
+	{
+		name: "targets missing from snapshot",
+		attack: func(t *testing.T, f *attackFixture) {
+			forgeSnapshot(t, f, func(meta map[string]authoring.FileMeta) {
+				delete(meta, authoring.RoleTargets)
+			})
+		},
+		expect: expectCause(errRollbackAttack),
+	},
+	{
+		name: "freeze with replayed metadata",
+		attack: func(t *testing.T, f *attackFixture) {
+			f.clock.AddTime(2 * tuftest.DefaultExpiry)
+		},
+		expect: expectCause(errFreezeAttack),
+	},
+	{
+		name: "freeze with expired timestamp",
+		attack: func(t *testing.T, f *attackFixture) {
+			require.NoError(t, f.server.SetExpires(authoring.RoleTimestamp, time.Now().Add(-time.Hour)))
+		},
+		expect: expectCause(errFreezeAttack),
+	},
+	{
+		name: "mix and match targets",
+		attack: func(t *testing.T, f *attackFixture) {
+			require.NoError(t, f.server.ServeVersion(authoring.RoleTargets, 2))
+		},
+		expect: expectCause(errHashIncorrect),
+	},
+	{
+		name: "endless target",
+		attack: func(t *testing.T, f *attackFixture) {
+			f.server.SetTargetFault("edge/target", tuftest.PadFault(1<<20))
+		},
+		download: "edge/target",
+		expect:   expectGenuine,
+	},
+	{
+		name: "endless snapshot",
+		attack: func(t *testing.T, f *attackFixture) {
+			f.server.SetRoleFault(authoring.RoleSnapshot, tuftest.PadFault(1<<20))
+		},
+		expect: func(t *testing.T, err error, _ []byte, f *attackFixture) {
+			// Only the length listed in the timestamp is read.
+			assert.NoError(t, err)
+		},
+	},
+	{
+		name: "arbitrary target",
+		attack: func(t *testing.T, f *attackFixture) {
+			f.server.SetMirrorContent("edge/target", []byte("malicious!!"))
+		},
+		download: "edge/target",
+		expect:   expectCause(errHashIncorrect),
+	},
+	{
+		name: "slow retrieval",
+		attack: func(t *testing.T, f *attackFixture) {
+			f.server.SetRoleFault(authoring.RoleTimestamp, tuftest.DelayFault(time.Minute))
+			passTime(f)
+		},
+		expect: expectCause(ErrSlowRetrieval),
+	},
+	{
+		name: "stalled target",
+		attack: func(t *testing.T, f *attackFixture) {
+			// The test server's client has no response header timeout.
+			f.server.SetTargetFault("edge/target", tuftest.DelayFault(time.Hour))
+			passTime(f)
+		},
+		download: "edge/target",
+		expect:   expectCause(ErrSlowRetrieval),
+	},
+	{
+		name: "trickled target",
+		attack: func(t *testing.T, f *attackFixture) {
+			f.server.SetTargetFault("edge/target", tuftest.SlowFault(10))
+			passTime(f)
+		},
+		download: "edge/target",
+		expect:   expectCause(ErrSlowRetrieval),
+	},
+	{
+		name: "compromised snapshot and timestamp keys",
+		attack: func(t *testing.T, f *attackFixture) {
+			rogue, err := authoring.GenerateSigner()
+			require.NoError(t, err)
+			published, _ := f.server.Role(authoring.RoleTargets)
+			var targets authoring.Targets
+			forgedTargets := forge(t, published, &targets, func() {
+				targets.Signed.Version++
+				targets.Signed.Targets["edge/target"] = authoring.NewFileMeta([]byte("malicious!!"))
+			}, rogue)
+			published, _ = f.server.Role(authoring.RoleSnapshot)
+			var snapshot authoring.Snapshot
+			forgedSnapshot := forge(t, published, &snapshot, func() {
+				snapshot.Signed.Version++
+				snapshot.Signed.Meta[authoring.RoleTargets] = authoring.NewFileMeta(forgedTargets)
+			}, f.server.Keys.Snapshot)
+			f.server.SetRoleFault(authoring.RoleTargets, tuftest.ReplaceFault(forgedTargets))
+			f.server.SetRoleFault(authoring.RoleSnapshot, tuftest.ReplaceFault(forgedSnapshot))
+			forgeTimestamp(t, f, forgedSnapshot)
+		},
+		expect: expectCause(errSignatureThresholdNotMet),
+	},
+	{
+		name: "timestamp signed by untrusted key",
+		attack: func(t *testing.T, f *attackFixture) {
+			rogue, err := authoring.GenerateSigner()
+			require.NoError(t, err)
+			published, _ := f.server.Role(authoring.RoleTimestamp)
+			var timestamp authoring.Timestamp
+			forged := forge(t, published, &timestamp, func() {
+				timestamp.Signed.Version++
+			}, rogue)
+			f.server.SetRoleFault(authoring.RoleTimestamp, tuftest.ReplaceFault(forged))
+		},
+		expect: expectCause(errSignatureThresholdNotMet),
+	},
+	{
+		name: "root rotation signed only by new key",
+		attack: func(t *testing.T, f *attackFixture) {
+			rogue, err := authoring.GenerateSigner()
+			require.NoError(t, err)
+			published, _ := f.server.Role(authoring.RoleRoot)
+			var root authoring.Root
+			forged := forge(t, published, &root, func() {
+				root.Signed.Version++
+				root.Signed.Keys = map[string]authoring.Key{rogue.ID(): rogue.Key()}
+				for name := range root.Signed.Roles {
+					root.Signed.Roles[name] = authoring.RoleKeys{KeyIDs: []string{rogue.ID()}, Threshold: 1}
+				}
+			}, rogue)
+			f.server.SetRoleFault("2.root", tuftest.ReplaceFault(forged))
+		},
+		expect: expectCause(errSignatureThresholdNotMet),
+	},
+}
+
+func TestAttacks(t *testing.T) {
+	for _, scenario := range attackScenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			f, cleanup := setupAttack(t)
+			defer cleanup()
+			if scenario.download != "" {
+				_, _, err := f.client.Update()
+				require.NoError(t, err)
+			}
+			before := trustedState(t, f.local)
+
+			scenario.attack(t, f)
+			var (
+				err        error
+				downloaded bytes.Buffer
+			)
+			if scenario.download != "" {
+				err = f.client.Download(scenario.download, &downloaded)
+			} else {
+				_, _, err = f.client.Update()
+			}
+			scenario.expect(t, err, downloaded.Bytes(), f)
+			assert.Equal(t, before, trustedState(t, f.local), "local repository changed")
+		})
+	}
+}
+
+// The versions of trusted targets roles are compared to the versions listed
+// in the new snapshot, not to the version of the snapshot itself.
+func TestTargetsVersionAheadOfSnapshot(t *testing.T) {
+	f, cleanup := setupAttack(t)
+	defer cleanup()
+	require.NoError(t, f.server.Update(func(repo *authoring.Repo) error {
+		repo.Targets.Signed.Version = 20
+		return nil
+	}))
+	_, _, err := f.client.Update()
+	require.NoError(t, err)
+	require.NoError(t, f.server.PublishTarget(authoring.RoleTargets, "edge/target", []byte("version three")))
+	_, _, err = f.client.Update()
+	require.NoError(t, err)
+}
@@ -0,0 +1,128 @@
+package authoring_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kolide/updater/tuf"
+	"github.com/kolide/updater/tuf/authoring"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testGUN = "kolide/authoring/test"
+
+func generateSigners(t *testing.T, n int) []*authoring.Signer {
+	var signers []*authoring.Signer
+	for i := 0; i < n; i++ {
+		signer, err := authoring.GenerateSigner()
+		require.NoError(t, err)
+		signers = append(signers, signer)
+	}
+	return signers
+}
+
+func TestKeyIDMatchesNotary(t *testing.T) {
+	buff, err := ioutil.ReadFile("../testdata/delegation/2/root.json")
+	require.NoError(t, err)
+	var root authoring.Root
+	require.NoError(t, json.Unmarshal(buff, &root))
+	require.NotEmpty(t, root.Signed.Keys)
+	for id, key := range root.Signed.Keys {
+		assert.Equal(t, id, key.ID())
+	}
+	// re-encoding the signed portion of a role produced by Notary gives back
+	// the bytes that were signed
+	var raw struct {
+		Signed json.RawMessage `json:"signed"`
+	}
+	require.NoError(t, json.Unmarshal(buff, &raw))
+	encoded, err := authoring.Marshal(root.Signed)
+	require.NoError(t, err)
+	assert.Equal(t, string(raw.Signed), string(encoded))
+}
+
+func TestParseSigner(t *testing.T) {
+	signer := generateSigners(t, 1)[0]
+	buff, err := signer.MarshalPEM()
+	require.NoError(t, err)
+	parsed, err := authoring.ParseSigner(buff)
+	require.NoError(t, err)
+	assert.Equal(t, signer.ID(), parsed.ID())
+
+	_, err = authoring.ParseSigner([]byte("not a key"))
+	assert.Error(t, err)
+}
+
+// publish writes the repository where a file URL notary and mirror expect it.
+func publish(t *testing.T, repo *authoring.Repo, dir string, targets map[string][]byte) {
+	files, err := repo.Publish()
+	require.NoError(t, err)
+	require.NoError(t, files.Write(filepath.Join(dir, "notary", "v2", filepath.FromSlash(testGUN), "_trust", "tuf")))
+	for name, content := range targets {
+		path := filepath.Join(dir, "mirror", filepath.FromSlash(testGUN), filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, content, 0644))
+	}
+}
+
+func TestPublishedRepoIsTrusted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authoring")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	keys := generateSigners(t, 6)
+	root, err := keys[0].WithCertificate(testGUN, time.Now(), time.Now().Add(24*time.Hour))
+	require.NoError(t, err)
+	repo := authoring.NewRepo(time.Now().Add(24*time.Hour), root, keys[1], keys[2], keys[3])
+	v1 := []byte("version one")
+	require.NoError(t, repo.AddTarget(authoring.RoleTargets, "edge/target", v1))
+	publish(t, repo, dir, map[string][]byte{"edge/target": v1})
+
+	rootJSON, err := ioutil.ReadFile(filepath.Join(dir, "notary", "v2", filepath.FromSlash(testGUN), "_trust", "tuf", "root.json"))
+	require.NoError(t, err)
+	sum := sha256.Sum256(rootJSON)
+	settings := &tuf.Settings{
+		LocalRepoPath: filepath.Join(dir, "local"),
+		NotaryURL:     "file://" + filepath.ToSlash(filepath.Join(dir, "notary")),
+		MirrorURL:     "file://" + filepath.ToSlash(filepath.Join(dir, "mirror")),
+		GUN:           testGUN,
+	}
+	require.NoError(t, tuf.Bootstrap(settings, hex.EncodeToString(sum[:]), tuf.WithFileURLs()))
+
+	// rotate the root key, and delegate a new target to another key
+	require.NoError(t, repo.SetKeys(authoring.RoleRoot, 1, keys[4]))
+	require.NoError(t, repo.AddDelegation(authoring.RoleTargets, "targets/releases", []string{"releases/"}, keys[5]))
+	v2 := []byte("version two")
+	require.NoError(t, repo.AddTarget("targets/releases", "releases/target", v2))
+	publish(t, repo, dir, map[string][]byte{"releases/target": v2})
+	assert.Equal(t, 2, repo.Root.Signed.Version)
+	assert.Equal(t, 2, repo.Targets.Signed.Version)
+
+	client, err := tuf.NewClient(settings, tuf.WithFileURLs())
+	require.NoError(t, err)
+	defer client.Stop()
+	files, latest, err := client.Update()
+	require.NoError(t, err)
+	assert.False(t, latest)
+	assert.Contains(t, files, "edge/target")
+	assert.Contains(t, files, "releases/target")
+	rdr, err := client.Open("releases/target")
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(rdr)
+	rdr.Close()
+	require.NoError(t, err)
+	assert.Equal(t, v2, content)
+
+	// publishing without changes doesn't create new versions
+	before := repo.Timestamp.Signed.Version
+	_, err = repo.Publish()
+	require.NoError(t, err)
+	assert.Equal(t, before, repo.Timestamp.Signed.Version)
+}
@@ -0,0 +1,190 @@
+package authoring
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"time"
+
+	cjson "github.com/docker/go/canonical/json"
+	"github.com/pkg/errors"
+)
+
+const (
+	// KeyTypeECDSA is a public key stored as base64 encoded PKIX DER.
+	KeyTypeECDSA = "ecdsa"
+	// KeyTypeECDSAx509 is a public key stored as a base64 encoded PEM
+	// certificate. Notary uses it for root keys.
+	KeyTypeECDSAx509 = "ecdsa-x509"
+	// MethodECDSA is the only signing method the client supports.
+	MethodECDSA = "ecdsa"
+)
+
+var errNotECDSA = errors.New("key is not an ECDSA private key")
+
+// Key is a public key as it appears in root and delegation metadata.
+type Key struct {
+	KeyType string `json:"keytype"`
+	KeyVal  KeyVal `json:"keyval"`
+}
+
+// KeyVal holds the public key. Private is always null in published metadata.
+type KeyVal struct {
+	Private *string `json:"private"`
+	Public  string  `json:"public"`
+}
+
+// ID returns the key ID used by Notary, the hex encoded SHA-256 digest of the
+// canonical JSON encoding of the key.
+func (k Key) ID() string {
+	// Marshalling a struct of strings can't fail.
+	buff, _ := cjson.MarshalCanonical(k)
+	sum := sha256.Sum256(buff)
+	return hex.EncodeToString(sum[:])
+}
+
+// Signer signs metadata with an ECDSA private key.
+type Signer struct {
+	private *ecdsa.PrivateKey
+	public  Key
+}
+
+// GenerateSigner creates a Signer with a new P-256 key.
+func GenerateSigner() (*Signer, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generating ecdsa key")
+	}
+	return newSigner(private)
+}
+
+// LoadSigner reads an unencrypted ECDSA private key from a PEM file.
+func LoadSigner(path string) (*Signer, error) {
+	buff, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading private key")
+	}
+	return ParseSigner(buff)
+}
+
+// ParseSigner parses an unencrypted ECDSA private key in either SEC 1
+// ("EC PRIVATE KEY") or PKCS #8 ("PRIVATE KEY") PEM form. PEM headers, such as
+// the role header written by Notary, are ignored.
+func ParseSigner(pemBytes []byte) (*Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		private, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing ecdsa private key")
+		}
+		return newSigner(private)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing pkcs8 private key")
+		}
+		private, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errNotECDSA
+		}
+		return newSigner(private)
+	case "ENCRYPTED PRIVATE KEY":
+		return nil, errors.New("encrypted private keys are not supported")
+	default:
+		return nil, errors.Errorf("unexpected PEM block %q", block.Type)
+	}
+}
+
+func newSigner(private *ecdsa.PrivateKey) (*Signer, error) {
+	der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling public key")
+	}
+	return &Signer{
+		private: private,
+		public: Key{
+			KeyType: KeyTypeECDSA,
+			KeyVal:  KeyVal{Public: base64.StdEncoding.EncodeToString(der)},
+		},
+	}, nil
+}
+
+// WithCertificate returns a Signer for the same private key whose public key
+// is a self signed certificate, which is how Notary publishes root keys.
+func (s *Signer) WithCertificate(commonName string, notBefore, notAfter time.Time) (*Signer, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "generating certificate serial number")
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &s.private.PublicKey, s.private)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating certificate")
+	}
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return &Signer{
+		private: s.private,
+		public: Key{
+			KeyType: KeyTypeECDSAx509,
+			KeyVal:  KeyVal{Public: base64.StdEncoding.EncodeToString(cert)},
+		},
+	}, nil
+}
+
+// MarshalPEM encodes the private key in SEC 1 PEM form.
+func (s *Signer) MarshalPEM() ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(s.private)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling private key")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// Key returns the public key that verifies signatures made by s.
+func (s *Signer) Key() Key {
+	return s.public
+}
+
+// ID returns the ID of the public key.
+func (s *Signer) ID() string {
+	return s.public.ID()
+}
+
+// Sign signs the SHA-256 digest of data. The signature is the concatenation
+// of r and s, each padded to the size of the curve.
+func (s *Signer) Sign(data []byte) (Signature, error) {
+	digest := sha256.Sum256(data)
+	r, ss, err := ecdsa.Sign(rand.Reader, s.private, digest[:])
+	if err != nil {
+		return Signature{}, errors.Wrap(err, "signing")
+	}
+	size := (s.private.Params().BitSize + 7) >> 3
+	sig := make([]byte, 2*size)
+	r.FillBytes(sig[:size])
+	ss.FillBytes(sig[size:])
+	return Signature{
+		KeyID:  s.ID(),
+		Method: MethodECDSA,
+		Value:  base64.StdEncoding.EncodeToString(sig),
+	}, nil
+}
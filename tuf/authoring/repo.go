@@ -0,0 +1,337 @@
+package authoring
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Files maps role names to published metadata. Delegated roles are named by
+// their path, such as "targets/releases", and every published version of the
+// root role is also available as "<version>.root".
+type Files map[string][]byte
+
+// Write saves each role to dir as <name>.json, the layout used by the local
+// repository and by a Notary server's _trust/tuf directory.
+func (f Files) Write(dir string) error {
+	for name, buff := range f {
+		fileName := filepath.Join(dir, filepath.FromSlash(name)+".json")
+		if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+			return errors.Wrapf(err, "creating directory for %q", name)
+		}
+		if err := ioutil.WriteFile(fileName, buff, 0644); err != nil {
+			return errors.Wrapf(err, "writing %q", name)
+		}
+	}
+	return nil
+}
+
+// Repo is a repository being authored. The roles are exported so that any
+// field can be changed before calling Publish, which versions and signs the
+// roles that changed and regenerates snapshot and timestamp.
+type Repo struct {
+	Root      Root
+	Targets   Targets
+	Delegated map[string]*Targets
+	Snapshot  Snapshot
+	Timestamp Timestamp
+
+	signers map[string][]*Signer
+	// parents maps delegated roles to the role that delegates to them.
+	parents map[string]string
+	// rootSigners signed the last published root, and must also sign the next
+	// one so that clients can follow the rotation.
+	rootSigners []*Signer
+	// signed is the signed portion of each role as of the last Publish.
+	signed   map[string][]byte
+	versions map[string]int
+	files    Files
+}
+
+// NewRepo creates a repository with version 1 of each top level role, each
+// trusting a single key. All roles expire at expires.
+func NewRepo(expires time.Time, root, targets, snapshot, timestamp *Signer) *Repo {
+	r := &Repo{
+		Root: Root{Signed: SignedRoot{
+			Type:    typeRoot,
+			Expires: expires,
+			Keys:    make(map[string]Key),
+			Roles:   make(map[string]RoleKeys),
+			Version: 1,
+		}},
+		Targets:   Targets{Signed: newSignedTargets(expires)},
+		Delegated: make(map[string]*Targets),
+		Snapshot: Snapshot{Signed: SignedSnapshot{
+			Type:    typeSnapshot,
+			Expires: expires,
+			Version: 1,
+			Meta:    make(map[string]FileMeta),
+		}},
+		Timestamp: Timestamp{Signed: SignedTimestamp{
+			Type:    typeTimestamp,
+			Expires: expires,
+			Version: 1,
+			Meta:    make(map[string]FileMeta),
+		}},
+		signers:  make(map[string][]*Signer),
+		parents:  make(map[string]string),
+		signed:   make(map[string][]byte),
+		versions: make(map[string]int),
+		files:    make(Files),
+	}
+	r.setRootKeys(RoleRoot, 1, []*Signer{root})
+	r.setRootKeys(RoleTargets, 1, []*Signer{targets})
+	r.setRootKeys(RoleSnapshot, 1, []*Signer{snapshot})
+	r.setRootKeys(RoleTimestamp, 1, []*Signer{timestamp})
+	return r
+}
+
+func newSignedTargets(expires time.Time) SignedTargets {
+	return SignedTargets{
+		Type: typeTargets,
+		Delegations: Delegations{
+			Keys:  make(map[string]Key),
+			Roles: []DelegationRole{},
+		},
+		Expires: expires,
+		Targets: make(map[string]FileMeta),
+		Version: 1,
+	}
+}
+
+// SetKeys replaces the keys trusted for role, which may be a top level or a
+// delegated role. The threshold is not checked against the number of
+// signers so that metadata which doesn't meet its threshold can be produced.
+// Changing the root keys is a root rotation: the next root is signed by both
+// the old and the new keys.
+func (r *Repo) SetKeys(role string, threshold int, signers ...*Signer) error {
+	switch role {
+	case RoleRoot, RoleTargets, RoleSnapshot, RoleTimestamp:
+		r.setRootKeys(role, threshold, signers)
+		return nil
+	}
+	parent, ok := r.parents[role]
+	if !ok {
+		return errors.Errorf("unknown role %q", role)
+	}
+	delegator, err := r.targetsRole(parent)
+	if err != nil {
+		return err
+	}
+	for i, delegation := range delegator.Signed.Delegations.Roles {
+		if delegation.Name == role {
+			delegator.Signed.Delegations.Roles[i].RoleKeys = roleKeys(threshold, signers)
+		}
+	}
+	r.signers[role] = signers
+	r.pruneDelegationKeys(delegator)
+	return nil
+}
+
+func (r *Repo) setRootKeys(role string, threshold int, signers []*Signer) {
+	r.Root.Signed.Roles[role] = roleKeys(threshold, signers)
+	r.signers[role] = signers
+	keys := make(map[string]Key)
+	for _, name := range []string{RoleRoot, RoleTargets, RoleSnapshot, RoleTimestamp} {
+		for _, signer := range r.signers[name] {
+			keys[signer.ID()] = signer.Key()
+		}
+	}
+	r.Root.Signed.Keys = keys
+}
+
+func roleKeys(threshold int, signers []*Signer) RoleKeys {
+	ids := []string{}
+	for _, signer := range signers {
+		ids = append(ids, signer.ID())
+	}
+	return RoleKeys{KeyIDs: ids, Threshold: threshold}
+}
+
+// pruneDelegationKeys rebuilds the delegation keys of a targets role from the
+// signers of the roles it delegates to.
+func (r *Repo) pruneDelegationKeys(delegator *Targets) {
+	keys := make(map[string]Key)
+	for _, delegation := range delegator.Signed.Delegations.Roles {
+		for _, signer := range r.signers[delegation.Name] {
+			keys[signer.ID()] = signer.Key()
+		}
+	}
+	delegator.Signed.Delegations.Keys = keys
+}
+
+// AddDelegation delegates the target paths matching paths from parent, which
+// is "targets" or an existing delegated role, to a new role called name.
+// Following Notary, name must be a path below its parent, for example
+// "targets/releases". The new role trusts signers with a threshold of 1.
+func (r *Repo) AddDelegation(parent, name string, paths []string, signers ...*Signer) error {
+	delegator, err := r.targetsRole(parent)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(name, parent+"/") || path.Clean(name) != name {
+		return errors.Errorf("delegated role %q must be below %q", name, parent)
+	}
+	if _, ok := r.Delegated[name]; ok {
+		return errors.Errorf("role %q already exists", name)
+	}
+	delegator.Signed.Delegations.Roles = append(delegator.Signed.Delegations.Roles, DelegationRole{
+		RoleKeys: roleKeys(1, signers),
+		Name:     name,
+		Paths:    paths,
+	})
+	r.signers[name] = signers
+	r.parents[name] = parent
+	r.pruneDelegationKeys(delegator)
+	r.Delegated[name] = &Targets{Signed: newSignedTargets(delegator.Signed.Expires)}
+	return nil
+}
+
+// SetTarget adds or replaces a target in a targets role.
+func (r *Repo) SetTarget(role, name string, meta FileMeta) error {
+	targets, err := r.targetsRole(role)
+	if err != nil {
+		return err
+	}
+	targets.Signed.Targets[name] = meta
+	return nil
+}
+
+// AddTarget adds content to a targets role as name.
+func (r *Repo) AddTarget(role, name string, content []byte) error {
+	return r.SetTarget(role, name, NewFileMeta(content))
+}
+
+// RemoveTarget removes a target from a targets role.
+func (r *Repo) RemoveTarget(role, name string) error {
+	targets, err := r.targetsRole(role)
+	if err != nil {
+		return err
+	}
+	delete(targets.Signed.Targets, name)
+	return nil
+}
+
+func (r *Repo) targetsRole(role string) (*Targets, error) {
+	if role == RoleTargets {
+		return &r.Targets, nil
+	}
+	targets, ok := r.Delegated[role]
+	if !ok {
+		return nil, errors.Errorf("unknown targets role %q", role)
+	}
+	return targets, nil
+}
+
+// Publish signs every role that changed since the last Publish, incrementing
+// its version unless the version was already raised, then regenerates
+// snapshot and timestamp to match. It returns the complete set of published
+// files.
+func (r *Repo) Publish() (Files, error) {
+	rootSigners := mergeSigners(r.rootSigners, r.signers[RoleRoot])
+	rootChanged, err := r.publish(RoleRoot, &r.Root, &r.Root.Signed.Version, rootSigners)
+	if err != nil {
+		return nil, err
+	}
+	if rootChanged {
+		r.rootSigners = r.signers[RoleRoot]
+		r.files[strconv.Itoa(r.Root.Signed.Version)+"."+RoleRoot] = r.files[RoleRoot]
+	}
+
+	var names []string
+	for name := range r.Delegated {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range append(names, RoleTargets) {
+		targets, _ := r.targetsRole(name)
+		if _, err := r.publish(name, targets, &targets.Signed.Version, r.signers[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	meta := make(map[string]FileMeta)
+	for _, name := range append(names, RoleRoot, RoleTargets) {
+		meta[name] = r.roleMeta(name)
+	}
+	r.Snapshot.Signed.Meta = meta
+	if _, err := r.publish(RoleSnapshot, &r.Snapshot, &r.Snapshot.Signed.Version, r.signers[RoleSnapshot]); err != nil {
+		return nil, err
+	}
+
+	r.Timestamp.Signed.Meta = map[string]FileMeta{RoleSnapshot: r.roleMeta(RoleSnapshot)}
+	if _, err := r.publish(RoleTimestamp, &r.Timestamp, &r.Timestamp.Signed.Version, r.signers[RoleTimestamp]); err != nil {
+		return nil, err
+	}
+
+	files := make(Files)
+	for name, buff := range r.files {
+		files[name] = buff
+	}
+	return files, nil
+}
+
+// roleMeta describes the published file of a role, including its version.
+func (r *Repo) roleMeta(name string) FileMeta {
+	meta := NewFileMeta(r.files[name])
+	meta.Version = r.versions[name]
+	return meta
+}
+
+// signable is implemented by each of the role types.
+type signable interface {
+	Sign(signers ...*Signer) error
+	signedPortion() interface{}
+}
+
+// publish signs and encodes a role if its signed portion changed since it was
+// last published, and reports whether it did.
+func (r *Repo) publish(name string, role signable, version *int, signers []*Signer) (bool, error) {
+	current, err := Marshal(role.signedPortion())
+	if err != nil {
+		return false, err
+	}
+	if _, ok := r.files[name]; ok && bytes.Equal(current, r.signed[name]) {
+		return false, nil
+	}
+	if previous, ok := r.versions[name]; ok && *version <= previous {
+		*version = previous + 1
+	}
+	if err := role.Sign(signers...); err != nil {
+		return false, errors.Wrapf(err, "signing %q", name)
+	}
+	buff, err := Marshal(role)
+	if err != nil {
+		return false, err
+	}
+	if r.signed[name], err = Marshal(role.signedPortion()); err != nil {
+		return false, err
+	}
+	r.versions[name] = *version
+	r.files[name] = buff
+	return true, nil
+}
+
+// mergeSigners returns the signers in a followed by those in b that have a
+// different key.
+func mergeSigners(a, b []*Signer) []*Signer {
+	result := append([]*Signer{}, a...)
+	seen := make(map[string]bool)
+	for _, signer := range a {
+		seen[signer.ID()] = true
+	}
+	for _, signer := range b {
+		if !seen[signer.ID()] {
+			result = append(result, signer)
+		}
+	}
+	return result
+}
@@ -0,0 +1,204 @@
+// Package authoring creates and signs TUF repositories in the format read by
+// the tuf package, so that test and small standalone repositories can be
+// produced without a Notary server.
+package authoring
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"time"
+
+	cjson "github.com/docker/go/canonical/json"
+	"github.com/pkg/errors"
+)
+
+// Names of the top level roles.
+const (
+	RoleRoot      = "root"
+	RoleTargets   = "targets"
+	RoleSnapshot  = "snapshot"
+	RoleTimestamp = "timestamp"
+)
+
+// Values of the _type field written by Notary.
+const (
+	typeRoot      = "Root"
+	typeTargets   = "Targets"
+	typeSnapshot  = "Snapshot"
+	typeTimestamp = "Timestamp"
+)
+
+// Signature is a signature over the canonical JSON of a role's signed
+// portion.
+type Signature struct {
+	KeyID  string `json:"keyid"`
+	Method string `json:"method"`
+	Value  string `json:"sig"`
+}
+
+// FileMeta is the length and hashes of a target or role file, and the
+// version of a role listed in snapshot or timestamp metadata.
+type FileMeta struct {
+	Hashes  map[string]string `json:"hashes"`
+	Length  int64             `json:"length"`
+	Version int               `json:"version,omitempty"`
+	// Custom is application specific information about a target.
+	Custom *cjson.RawMessage `json:"custom,omitempty"`
+}
+
+// NewFileMeta returns the length and SHA-256 and SHA-512 hashes of content.
+func NewFileMeta(content []byte) FileMeta {
+	sum256 := sha256.Sum256(content)
+	sum512 := sha512.Sum512(content)
+	return FileMeta{
+		Hashes: map[string]string{
+			"sha256": base64.StdEncoding.EncodeToString(sum256[:]),
+			"sha512": base64.StdEncoding.EncodeToString(sum512[:]),
+		},
+		Length: int64(len(content)),
+	}
+}
+
+// RoleKeys lists the keys trusted for a role and how many of them must sign.
+type RoleKeys struct {
+	KeyIDs    []string `json:"keyids"`
+	Threshold int      `json:"threshold"`
+}
+
+// Root is the root role.
+type Root struct {
+	Signed     SignedRoot  `json:"signed"`
+	Signatures []Signature `json:"signatures"`
+}
+
+// SignedRoot is the signed portion of the root role.
+type SignedRoot struct {
+	Type               string              `json:"_type"`
+	ConsistentSnapshot bool                `json:"consistent_snapshot"`
+	Expires            time.Time           `json:"expires"`
+	Keys               map[string]Key      `json:"keys"`
+	Roles              map[string]RoleKeys `json:"roles"`
+	Version            int                 `json:"version"`
+}
+
+// Sign replaces the signatures on the role with signatures from signers.
+func (r *Root) Sign(signers ...*Signer) error {
+	sigs, err := sign(r.Signed, signers)
+	r.Signatures = sigs
+	return err
+}
+
+func (r *Root) signedPortion() interface{} { return r.Signed }
+
+// Targets is the top level targets role or a delegated targets role.
+type Targets struct {
+	Signed     SignedTargets `json:"signed"`
+	Signatures []Signature   `json:"signatures"`
+}
+
+// SignedTargets is the signed portion of a targets role.
+type SignedTargets struct {
+	Type        string              `json:"_type"`
+	Delegations Delegations         `json:"delegations"`
+	Expires     time.Time           `json:"expires"`
+	Targets     map[string]FileMeta `json:"targets"`
+	Version     int                 `json:"version"`
+}
+
+// Sign replaces the signatures on the role with signatures from signers.
+func (t *Targets) Sign(signers ...*Signer) error {
+	sigs, err := sign(t.Signed, signers)
+	t.Signatures = sigs
+	return err
+}
+
+func (t *Targets) signedPortion() interface{} { return t.Signed }
+
+// Delegations are the keys and roles a targets role delegates to.
+type Delegations struct {
+	Keys  map[string]Key   `json:"keys"`
+	Roles []DelegationRole `json:"roles"`
+}
+
+// DelegationRole is a role that is trusted for targets matching Paths.
+type DelegationRole struct {
+	RoleKeys
+	Name  string   `json:"name"`
+	Paths []string `json:"paths"`
+}
+
+// Snapshot is the snapshot role.
+type Snapshot struct {
+	Signed     SignedSnapshot `json:"signed"`
+	Signatures []Signature    `json:"signatures"`
+}
+
+// SignedSnapshot is the signed portion of the snapshot role.
+type SignedSnapshot struct {
+	Type    string              `json:"_type"`
+	Expires time.Time           `json:"expires"`
+	Version int                 `json:"version"`
+	Meta    map[string]FileMeta `json:"meta"`
+}
+
+// Sign replaces the signatures on the role with signatures from signers.
+func (s *Snapshot) Sign(signers ...*Signer) error {
+	sigs, err := sign(s.Signed, signers)
+	s.Signatures = sigs
+	return err
+}
+
+func (s *Snapshot) signedPortion() interface{} { return s.Signed }
+
+// Timestamp is the timestamp role.
+type Timestamp struct {
+	Signed     SignedTimestamp `json:"signed"`
+	Signatures []Signature     `json:"signatures"`
+}
+
+// SignedTimestamp is the signed portion of the timestamp role.
+type SignedTimestamp struct {
+	Type    string              `json:"_type"`
+	Expires time.Time           `json:"expires"`
+	Version int                 `json:"version"`
+	Meta    map[string]FileMeta `json:"meta"`
+}
+
+// Sign replaces the signatures on the role with signatures from signers.
+func (t *Timestamp) Sign(signers ...*Signer) error {
+	sigs, err := sign(t.Signed, signers)
+	t.Signatures = sigs
+	return err
+}
+
+func (t *Timestamp) signedPortion() interface{} { return t.Signed }
+
+// Marshal encodes a role as canonical JSON, the form in which roles are
+// published and hashed.
+func Marshal(role interface{}) ([]byte, error) {
+	buff, err := cjson.MarshalCanonical(role)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling role")
+	}
+	return buff, nil
+}
+
+func sign(signed interface{}, signers []*Signer) ([]Signature, error) {
+	if len(signers) == 0 {
+		return nil, errors.New("at least one signer is required")
+	}
+	buff, err := Marshal(signed)
+	if err != nil {
+		return nil, err
+	}
+	sigs := []Signature{}
+	for _, signer := range signers {
+		sig, err := signer.Sign(buff)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
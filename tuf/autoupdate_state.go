@@ -0,0 +1,136 @@
+package tuf
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// autoupdateStateFile is kept in the staging path, apart from the TUF
+// metadata in the local repository.
+const autoupdateStateFile = ".autoupdate.json"
+
+// autoupdateState is information about autoupdate targets that must survive
+// restarts of the hosting application.
+type autoupdateState struct {
+	// Delivered contains the version of each target that was last installed
+	// in the staging path. It is independent of the local TUF repository
+	// which can be updated before a new target is successfully downloaded.
+	Delivered map[string]FileIntegrityMeta `json:"delivered"`
+	// Previous contains the version of each target that was delivered before
+	// the current one, which is what Installer.Rollback restores.
+	Previous map[string]FileIntegrityMeta `json:"previous"`
+	// Rejected contains versions of targets that failed a health check and
+	// must not be installed again.
+	Rejected map[string][]FileIntegrityMeta `json:"rejected"`
+
+	path string
+}
+
+func loadAutoupdateState(stagingPath string) (*autoupdateState, error) {
+	state := &autoupdateState{
+		Delivered: make(map[string]FileIntegrityMeta),
+		Previous:  make(map[string]FileIntegrityMeta),
+		Rejected:  make(map[string][]FileIntegrityMeta),
+		path:      filepath.Join(stagingPath, autoupdateStateFile),
+	}
+	buff, err := ioutil.ReadFile(state.path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading autoupdate state")
+	}
+	if err := json.Unmarshal(buff, state); err != nil {
+		return nil, errors.Wrap(err, "decoding autoupdate state")
+	}
+	if state.Delivered == nil {
+		state.Delivered = make(map[string]FileIntegrityMeta)
+	}
+	if state.Previous == nil {
+		state.Previous = make(map[string]FileIntegrityMeta)
+	}
+	if state.Rejected == nil {
+		state.Rejected = make(map[string][]FileIntegrityMeta)
+	}
+	return state, nil
+}
+
+func (s *autoupdateState) isRejected(targetName string, fim FileIntegrityMeta) bool {
+	for _, rejected := range s.Rejected[targetName] {
+		if rejected.Equal(fim) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *autoupdateState) reject(targetName string, fim FileIntegrityMeta) {
+	if !s.isRejected(targetName, fim) {
+		s.Rejected[targetName] = append(s.Rejected[targetName], fim)
+	}
+}
+
+// deliver records that fim was installed over the version that was delivered
+// before it, if any.
+func (s *autoupdateState) deliver(targetName string, fim FileIntegrityMeta) {
+	if delivered, ok := s.Delivered[targetName]; ok {
+		s.Previous[targetName] = delivered
+	} else {
+		delete(s.Previous, targetName)
+	}
+	s.Delivered[targetName] = fim
+}
+
+// rollback records that the delivered version of a target was replaced by the
+// previous version, which is returned. The rolled back version is rejected.
+// If the previous version is unknown the zero value is returned, and nothing
+// is recorded as delivered so the next update installs a new version.
+func (s *autoupdateState) rollback(targetName string) FileIntegrityMeta {
+	if delivered, ok := s.Delivered[targetName]; ok {
+		s.reject(targetName, delivered)
+	}
+	previous, ok := s.Previous[targetName]
+	if ok {
+		s.Delivered[targetName] = previous
+	} else {
+		delete(s.Delivered, targetName)
+	}
+	delete(s.Previous, targetName)
+	return previous
+}
+
+// save writes the state to a temporary file and renames it into place so a
+// crash can't leave a partially written state file.
+func (s *autoupdateState) save() error {
+	buff, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, "encoding autoupdate state")
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return errors.Wrap(err, "creating autoupdate state directory")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), autoupdateStateFile)
+	if err != nil {
+		return errors.Wrap(err, "creating autoupdate state file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buff); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "writing autoupdate state")
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "syncing autoupdate state")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "closing autoupdate state")
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return errors.Wrap(err, "saving autoupdate state")
+	}
+	return nil
+}
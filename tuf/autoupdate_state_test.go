@@ -0,0 +1,212 @@
+package tuf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoupdateStateRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	state, err := loadAutoupdateState(dir)
+	require.Nil(t, err)
+	assert.Empty(t, state.Delivered)
+	assert.Empty(t, state.Rejected)
+
+	good := testFIM([]byte("good"))
+	bad := testFIM([]byte("bad"))
+	state.Delivered["target"] = good
+	state.reject("target", bad)
+	state.reject("target", bad)
+	require.Nil(t, state.save())
+
+	state, err = loadAutoupdateState(dir)
+	require.Nil(t, err)
+	assert.True(t, state.Delivered["target"].Equal(good))
+	assert.Len(t, state.Rejected["target"], 1)
+	assert.True(t, state.isRejected("target", bad))
+	assert.False(t, state.isRejected("target", good))
+	assert.False(t, state.isRejected("other", bad))
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, autoupdateStateFile), []byte("{"), 0644))
+	_, err = loadAutoupdateState(dir)
+	assert.NotNil(t, err)
+}
+
+// If metadata is saved but the target is never downloaded, for example because
+// the application stopped, the target must be downloaded the next time.
+func TestDeliveryNotLostAfterMetadataUpdate(t *testing.T) {
+	settings, stageDir, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	k := clock.NewMockClock(testTime)
+
+	var called bool
+	onUpdate := func(stagingPath string, err error) {
+		called = true
+	}
+	client, err := NewClient(
+		settings, WithHTTPClient(testHTTPClient()),
+		withClock(k),
+		loadOnStart(false),
+		WithAutoUpdate("edge/target", stageDir, onUpdate),
+	)
+	require.Nil(t, err)
+	_, latest, err := client.Update()
+	require.Nil(t, err)
+	require.False(t, latest)
+	client.Stop()
+	require.False(t, called)
+
+	var (
+		path  string
+		cbErr error
+	)
+	onUpdate = func(stagingPath string, err error) {
+		path = stagingPath
+		cbErr = err
+	}
+	client, err = NewClient(
+		settings, WithHTTPClient(testHTTPClient()),
+		withClock(k),
+		WithAutoUpdate("edge/target", stageDir, onUpdate),
+	)
+	require.Nil(t, err)
+	client.Stop()
+	require.Nil(t, cbErr)
+	assert.Equal(t, filepath.Join(stageDir, "edge", "target"), path)
+
+	state, err := loadAutoupdateState(stageDir)
+	require.Nil(t, err)
+	delivered, ok := state.Delivered["edge/target"]
+	require.True(t, ok)
+	fi, err := os.Stat(path)
+	require.Nil(t, err)
+	assert.Equal(t, fi.Size(), delivered.Length)
+}
+
+// Without a record of the delivered target, the target in the local
+// repository is only assumed to be delivered if it is in the staging path.
+func TestDeliveryWithoutState(t *testing.T) {
+	settings, stageDir, cleanup := setupEndToEndTest(t, 2, 2)
+	defer cleanup()
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	k := clock.NewMockClock(testTime)
+
+	delivered := make(chan error, 1)
+	onUpdate := func(stagingPath string, err error) {
+		delivered <- err
+	}
+	newClient := func() *Client {
+		client, err := NewClient(
+			settings, WithHTTPClient(testHTTPClient()),
+			withClock(k),
+			loadOnStart(false),
+			WithAutoUpdate("edge/target", stageDir, onUpdate),
+		)
+		require.Nil(t, err)
+		return client
+	}
+	client := newClient()
+	state, err := loadAutoupdateState(stageDir)
+	require.Nil(t, err)
+	assert.Empty(t, state.Delivered)
+	client.forceAutoUpdate <- struct{}{}
+	select {
+	case err := <-delivered:
+		require.Nil(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("target was not delivered")
+	}
+	client.Stop()
+
+	// once the target is in place, losing the state doesn't deliver it again
+	require.Nil(t, os.Remove(filepath.Join(stageDir, autoupdateStateFile)))
+	client = newClient()
+	client.forceAutoUpdate <- struct{}{}
+	client.Stop()
+	assert.Empty(t, delivered)
+	state, err = loadAutoupdateState(stageDir)
+	require.Nil(t, err)
+	_, ok := state.Delivered["edge/target"]
+	assert.True(t, ok)
+}
+
+func TestAutoupdateStateRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	state, err := loadAutoupdateState(dir)
+	require.Nil(t, err)
+	first := testFIM([]byte("first"))
+	second := testFIM([]byte("second"))
+	state.deliver("target", first)
+	state.deliver("target", second)
+	assert.True(t, state.Previous["target"].Equal(first))
+
+	restored := state.rollback("target")
+	assert.True(t, restored.Equal(first))
+	assert.True(t, state.Delivered["target"].Equal(first))
+	assert.True(t, state.isRejected("target", second))
+	assert.Empty(t, state.Previous)
+
+	// the version before first is unknown
+	restored = state.rollback("target")
+	assert.True(t, restored.Equal(FileIntegrityMeta{}))
+	assert.Empty(t, state.Delivered)
+	assert.True(t, state.isRejected("target", first))
+}
+
+// A version that is rolled back manually is not installed again.
+func TestRollbackRejectsVersion(t *testing.T) {
+	settings, stageDir, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	k := clock.NewMockClock(testTime)
+
+	installed := filepath.Join(stageDir, "edge", "target")
+	require.Nil(t, os.MkdirAll(filepath.Dir(installed), 0755))
+	require.Nil(t, ioutil.WriteFile(installed, []byte("working version"), 0755))
+
+	var called bool
+	onUpdate := func(stagingPath string, err error) {
+		require.Nil(t, err)
+		called = true
+	}
+	newClient := func() *Client {
+		client, err := NewClient(
+			settings, WithHTTPClient(testHTTPClient()),
+			withClock(k),
+			WithAutoUpdate("edge/target", stageDir, onUpdate),
+		)
+		require.Nil(t, err)
+		return client
+	}
+	client := newClient()
+	require.Nil(t, client.Rollback())
+	client.Stop()
+	require.True(t, called)
+	buff, err := ioutil.ReadFile(installed)
+	require.Nil(t, err)
+	assert.Equal(t, "working version", string(buff))
+
+	state, err := loadAutoupdateState(stageDir)
+	require.Nil(t, err)
+	assert.Empty(t, state.Delivered)
+	assert.Len(t, state.Rejected["edge/target"], 1)
+
+	called = false
+	client = newClient()
+	client.Stop()
+	assert.False(t, called)
+}
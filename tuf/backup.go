@@ -0,0 +1,326 @@
+package tuf
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/pkg/errors"
+)
+
+// RoleInfo describes the version and expiration date of a TUF role stored
+// in a local repository. Version is zero if the role could not be read.
+type RoleInfo struct {
+	Role    string
+	Version int
+	Expires time.Time
+}
+
+// Backup is a generation of the local TUF repository that was saved before
+// the repository was replaced with newer metadata from Notary. All the files
+// in a generation share the same Tag, which is the time the backup was made.
+type Backup struct {
+	Tag     string
+	Created time.Time
+	Roles   []RoleInfo
+}
+
+// roleHeader is used to read the version and expiration of any role without
+// knowing its type.
+type roleHeader struct {
+	Signed struct {
+		Expires time.Time `json:"expires"`
+		Version int       `json:"version"`
+	} `json:"signed"`
+}
+
+// ListBackups returns the backup generations found in the local TUF repository
+// at localRepoPath, most recent first.
+func ListBackups(localRepoPath string) ([]Backup, error) {
+	if err := checkForDirectoryPresence(localRepoPath); err != nil {
+		return nil, err
+	}
+	generations := make(map[string]*Backup)
+	err := filepath.Walk(localRepoPath, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || !backupMatcher.MatchString(path) {
+			return nil
+		}
+		tag := path[len(path)-19 : len(path)-5]
+		created, err := time.Parse(backupFileTimeTagFormat, tag)
+		if err != nil {
+			return errors.Wrapf(err, "parsing backup tag for %q", path)
+		}
+		rel, err := filepath.Rel(localRepoPath, path)
+		if err != nil {
+			return errors.Wrap(err, "listing backups")
+		}
+		// A damaged role is still listed so that it is obvious which
+		// generations are incomplete.
+		info, err := readRoleInfo(path)
+		if err != nil {
+			info = &RoleInfo{}
+		}
+		info.Role = filepath.ToSlash(strings.TrimSuffix(rel, "."+tag+".json"))
+		backup, ok := generations[tag]
+		if !ok {
+			backup = &Backup{Tag: tag, Created: created}
+			generations[tag] = backup
+		}
+		backup.Roles = append(backup.Roles, *info)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "listing backups")
+	}
+	var backups []Backup
+	for _, backup := range generations {
+		sort.Slice(backup.Roles, func(i, j int) bool { return backup.Roles[i].Role < backup.Roles[j].Role })
+		backups = append(backups, *backup)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Created.After(backups[j].Created) })
+	return backups, nil
+}
+
+// TrustedRoles returns the version and expiration date of the top level roles
+// in the local TUF repository, in the order they are refreshed.
+func TrustedRoles(localRepoPath string) ([]RoleInfo, error) {
+	if err := checkForDirectoryPresence(localRepoPath); err != nil {
+		return nil, err
+	}
+	var roles []RoleInfo
+	for _, name := range []role{roleRoot, roleTimestamp, roleSnapshot, roleTargets} {
+		info, err := readRoleInfo(filepath.Join(localRepoPath, string(name)+".json"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading trusted %s role", name)
+		}
+		info.Role = string(name)
+		roles = append(roles, *info)
+	}
+	return roles, nil
+}
+
+// ValidateBackup checks that the backup generation identified by tag is a
+// complete and correctly signed set of TUF roles. Expired roles are not
+// considered invalid because they will be replaced on the next update.
+func ValidateBackup(localRepoPath, tag string) error {
+	dir, err := ioutil.TempDir("", "tufbackup")
+	if err != nil {
+		return errors.Wrap(err, "creating backup validation directory")
+	}
+	defer os.RemoveAll(dir)
+	if err := extractBackup(localRepoPath, tag, dir); err != nil {
+		return errors.Wrap(err, "validating backup")
+	}
+	if err := verifyLocalRepo(dir); err != nil {
+		return errors.Wrapf(err, "validating backup %q", tag)
+	}
+	return nil
+}
+
+// RestoreBackup replaces the roles in the local TUF repository with the backup
+// generation identified by tag. The backup is validated first, and the current
+// contents of the repository are backed up so the restore can be undone. A
+// Client must not be running against localRepoPath while it is restored.
+func RestoreBackup(localRepoPath, tag string) error {
+	return restoreBackup(localRepoPath, tag, &clock.DefaultClock{})
+}
+
+func restoreBackup(localRepoPath, tag string, k clock.Clock) error {
+	if err := ValidateBackup(localRepoPath, tag); err != nil {
+		return err
+	}
+	current := k.Now().UTC().Format(backupFileTimeTagFormat)
+	if current != tag {
+		if err := backupTUFRepo(localRepoPath, current); err != nil {
+			return errors.Wrap(err, "backing up repo before restore")
+		}
+	}
+	if err := restoreTUFRepo(localRepoPath, tag); err != nil {
+		return errors.Wrapf(err, "restoring backup %q", tag)
+	}
+	return nil
+}
+
+func readRoleInfo(path string) (*RoleInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading role info")
+	}
+	defer f.Close()
+	var header roleHeader
+	if err := json.NewDecoder(f).Decode(&header); err != nil {
+		return nil, errors.Wrapf(err, "decoding role %q", path)
+	}
+	return &RoleInfo{Version: header.Signed.Version, Expires: header.Signed.Expires}, nil
+}
+
+// Copies each file in the backup generation identified by tag into dst using
+// normal TUF role file names.
+func extractBackup(tufRoot, tag, dst string) error {
+	if err := checkForDirectoryPresence(tufRoot); err != nil {
+		return err
+	}
+	suffix := "." + tag + ".json"
+	var found bool
+	err := filepath.Walk(tufRoot, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || !strings.HasSuffix(path, suffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(tufRoot, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, strings.TrimSuffix(rel, suffix)+".json")
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		found = true
+		return copy(path, target)
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("backup %q not found", tag)
+	}
+	return nil
+}
+
+// verifyLocalRepo checks signatures of every role in a local TUF repository
+// against the keys in its root role, and checks that the snapshot and each
+// targets role match the hashes and length listed by their parent, so that
+// roles from different versions of the repository can't be mixed.
+func verifyLocalRepo(dir string) error {
+	repo, err := newLocalRepo(dir)
+	if err != nil {
+		return err
+	}
+	root, err := repo.root()
+	if err != nil {
+		return err
+	}
+	keymap := keymapForSignatures(root)
+	if err := verifySignatures(root.Signed, keymap, root.Signatures, root.Signed.Roles[roleRoot].Threshold); err != nil {
+		return errors.Wrap(err, "root signature verification failed")
+	}
+	timestamp, err := repo.timestamp()
+	if err != nil {
+		return err
+	}
+	keys := getKeys(root, timestamp.Signatures)
+	if err := verifySignatures(timestamp.Signed, keys, timestamp.Signatures, root.Signed.Roles[roleTimestamp].Threshold); err != nil {
+		return errors.Wrap(err, "timestamp signature verification failed")
+	}
+	snapshot, err := repo.snapshot()
+	if err != nil {
+		return err
+	}
+	keys = getKeys(root, snapshot.Signatures)
+	if err := verifySignatures(snapshot.Signed, keys, snapshot.Signatures, root.Signed.Roles[roleSnapshot].Threshold); err != nil {
+		return errors.Wrap(err, "snapshot signature verification failed")
+	}
+	if err := verifyRoleFile(dir, string(roleSnapshot), timestamp.Signed.Meta); err != nil {
+		return err
+	}
+	fetcher, err := newVerifyingTargetFetcher(&localTargetFetcher{dir}, root)
+	if err != nil {
+		return err
+	}
+	targets, err := repo.targets(fetcher)
+	if err != nil {
+		return err
+	}
+	for name := range targets.targetLookup {
+		if err := verifyRoleFile(dir, name, snapshot.Signed.Meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyRoleFile checks a role in a local repository against the file
+// integrity information its parent role lists for it.
+func verifyRoleFile(dir, name string, meta map[role]FileIntegrityMeta) error {
+	fim, ok := meta[role(name)]
+	if !ok {
+		return errors.Errorf("fim data missing for %q", name)
+	}
+	f, err := os.Open(filepath.Join(dir, name+".json"))
+	if err != nil {
+		return errors.Wrapf(err, "reading %q", name)
+	}
+	defer f.Close()
+	if err := fim.verifyRole(f); err != nil {
+		return errors.Wrapf(err, "file integrity checks failed for %q", name)
+	}
+	return nil
+}
+
+// verifyingTargetFetcher checks the signatures of targets roles read from the
+// local repository. Because targets are visited in preorder, the keys that a
+// parent delegates are always saved before its children are read.
+type verifyingTargetFetcher struct {
+	fetcher roleFetcher
+	seen    map[string]struct{}
+	keys    map[keyID]Key
+	roles   map[string]Role
+}
+
+func newVerifyingTargetFetcher(fetcher roleFetcher, root *Root) (*verifyingTargetFetcher, error) {
+	rdr := &verifyingTargetFetcher{
+		fetcher: fetcher,
+		seen:    make(map[string]struct{}),
+		keys:    make(map[keyID]Key),
+		roles:   make(map[string]Role),
+	}
+	targetRole := root.Signed.Roles[roleTargets]
+	for _, id := range targetRole.KeyIDs {
+		key, ok := root.Signed.Keys[keyID(id)]
+		if !ok {
+			return nil, errors.New("no key present for key id")
+		}
+		rdr.keys[keyID(id)] = key
+	}
+	rdr.roles[string(roleTargets)] = targetRole
+	return rdr, nil
+}
+
+func (rdr *verifyingTargetFetcher) fetch(delegate string) (*Targets, error) {
+	if len(rdr.seen) > maxDelegationCount {
+		return nil, errTooManyDelegates
+	}
+	if _, ok := rdr.seen[delegate]; ok {
+		return nil, errTargetSeen
+	}
+	rdr.seen[delegate] = struct{}{}
+	target, err := rdr.fetcher.fetch(delegate)
+	if err != nil {
+		return nil, err
+	}
+	role, ok := rdr.roles[delegate]
+	if !ok {
+		return nil, errors.Errorf("unable to find role info for %q", delegate)
+	}
+	err = verifySignatures(target.Signed, rdr.keys, target.Signatures, role.Threshold)
+	if err != nil {
+		return nil, errors.Wrapf(err, "signature validation failed for role %q", delegate)
+	}
+	for id, key := range target.Signed.Delegations.Keys {
+		rdr.keys[id] = key
+	}
+	for _, delegate := range target.Signed.Delegations.Roles {
+		rdr.roles[delegate.Name] = delegate.Role
+	}
+	return target, nil
+}
@@ -0,0 +1,162 @@
+package tuf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListBackups(t *testing.T) {
+	olderBackupTag := time.Now().UTC().Add(-2 * time.Hour).Format(backupFileTimeTagFormat)
+	newerBackupTag := time.Now().UTC().Add(-1 * time.Hour).Format(backupFileTimeTagFormat)
+
+	repoDir, _, err := createMockRepo(testFilePaths)
+	require.Nil(t, err)
+	defer os.RemoveAll(repoDir)
+	require.Nil(t, backupTUFRepo(repoDir, olderBackupTag))
+	require.Nil(t, backupTUFRepo(repoDir, newerBackupTag))
+
+	backups, err := ListBackups(repoDir)
+	require.Nil(t, err)
+	require.Len(t, backups, 2)
+	// most recent first
+	assert.Equal(t, newerBackupTag, backups[0].Tag)
+	assert.Equal(t, olderBackupTag, backups[1].Tag)
+	require.Len(t, backups[0].Roles, len(testFilePaths))
+
+	roles := make(map[string]RoleInfo)
+	for _, info := range backups[0].Roles {
+		roles[info.Role] = info
+	}
+	for _, name := range []string{"root", "timestamp", "snapshot", "targets", "targets/role", "targets/role/foo", "targets/bar"} {
+		info, ok := roles[name]
+		require.True(t, ok, name)
+		assert.NotZero(t, info.Version, name)
+		assert.False(t, info.Expires.IsZero(), name)
+	}
+}
+
+func TestTrustedRoles(t *testing.T) {
+	repoDir, _, err := createMockRepo(testFilePaths)
+	require.Nil(t, err)
+	defer os.RemoveAll(repoDir)
+
+	roles, err := TrustedRoles(repoDir)
+	require.Nil(t, err)
+	require.Len(t, roles, 4)
+	for i, name := range []string{"root", "timestamp", "snapshot", "targets"} {
+		assert.Equal(t, name, roles[i].Role)
+		assert.NotZero(t, roles[i].Version, name)
+		assert.False(t, roles[i].Expires.IsZero(), name)
+	}
+
+	require.Nil(t, os.Remove(filepath.Join(repoDir, "snapshot.json")))
+	_, err = TrustedRoles(repoDir)
+	assert.NotNil(t, err)
+}
+
+func TestValidateAndRestoreBackup(t *testing.T) {
+	tag := time.Now().UTC().Add(-1 * time.Hour).Format(backupFileTimeTagFormat)
+
+	repoDir, _, err := createMockRepo(testFilePaths)
+	require.Nil(t, err)
+	defer os.RemoveAll(repoDir)
+	require.Nil(t, backupTUFRepo(repoDir, tag))
+
+	require.Nil(t, ValidateBackup(repoDir, tag))
+	assert.NotNil(t, ValidateBackup(repoDir, "20000101000000"))
+
+	// wedge the local repository, restoring should fix it
+	targetsFile := filepath.Join(repoDir, "targets.json")
+	require.Nil(t, ioutil.WriteFile(targetsFile, []byte("garbage"), 0644))
+	require.Nil(t, RestoreBackup(repoDir, tag))
+	require.Nil(t, verifyLocalRepo(repoDir))
+
+	backups, err := ListBackups(repoDir)
+	require.Nil(t, err)
+	// the wedged repo was backed up before it was restored
+	assert.Len(t, backups, 2)
+}
+
+func TestValidateBackupBadSignature(t *testing.T) {
+	tag := time.Now().UTC().Add(-1 * time.Hour).Format(backupFileTimeTagFormat)
+
+	repoDir, _, err := createMockRepo(testFilePaths)
+	require.Nil(t, err)
+	defer os.RemoveAll(repoDir)
+	require.Nil(t, backupTUFRepo(repoDir, tag))
+
+	delegate := filepath.Join(repoDir, "targets", "role."+tag+".json")
+	buff, err := ioutil.ReadFile(delegate)
+	require.Nil(t, err)
+	tampered := strings.Replace(string(buff), `"version":`, `"version":1`, 1)
+	require.NotEqual(t, string(buff), tampered)
+	require.Nil(t, ioutil.WriteFile(delegate, []byte(tampered), 0644))
+
+	err = ValidateBackup(repoDir, tag)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "targets/role")
+	assert.NotNil(t, RestoreBackup(repoDir, tag))
+}
+
+func TestValidateBackupMixAndMatch(t *testing.T) {
+	tag := time.Now().UTC().Add(-1 * time.Hour).Format(backupFileTimeTagFormat)
+
+	// a correctly signed snapshot from another version of the repository
+	otherSnapshot, err := ioutil.ReadFile(filepath.Join("testdata", "delegation", "1", "snapshot.json"))
+	require.Nil(t, err)
+
+	tests := map[string]func(current []byte) []byte{
+		"snapshot": func([]byte) []byte { return otherSnapshot },
+		// whitespace isn't signed, so the signature still verifies
+		"targets": func(current []byte) []byte { return append(current, '\n') },
+	}
+	for name, replace := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoDir, _, err := createMockRepo(testFilePaths)
+			require.Nil(t, err)
+			defer os.RemoveAll(repoDir)
+			require.Nil(t, backupTUFRepo(repoDir, tag))
+
+			backup := filepath.Join(repoDir, name+"."+tag+".json")
+			current, err := ioutil.ReadFile(backup)
+			require.Nil(t, err)
+			other := replace(current)
+			require.NotEqual(t, current, other)
+			require.Nil(t, ioutil.WriteFile(backup, other, 0644))
+
+			err = ValidateBackup(repoDir, tag)
+			require.NotNil(t, err)
+			assert.Contains(t, []error{errHashIncorrect, errLengthIncorrect}, errors.Cause(err), err.Error())
+			assert.NotNil(t, RestoreBackup(repoDir, tag))
+		})
+	}
+}
+
+func TestValidateBackupAfterUpdate(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	settings, _, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	client, err := NewClient(settings, WithHTTPClient(testHTTPClient()), withClock(clock.NewMockClock(testTime)))
+	require.Nil(t, err)
+	_, _, err = client.Update()
+	require.Nil(t, err)
+	client.Stop()
+
+	// roles are saved as they were served, so they still match their parents
+	require.Nil(t, verifyLocalRepo(settings.LocalRepoPath))
+	backups, err := ListBackups(settings.LocalRepoPath)
+	require.Nil(t, err)
+	require.NotEmpty(t, backups)
+	for _, backup := range backups {
+		assert.Nil(t, ValidateBackup(settings.LocalRepoPath, backup.Tag), backup.Tag)
+	}
+}
@@ -0,0 +1,123 @@
+package tuf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errRootDigestMismatch  = errors.New("root role does not match the pinned digest")
+	errAlreadyBootstrapped = errors.New("local repository already contains a root role")
+)
+
+// Bootstrap creates the local repository in settings.LocalRepoPath from the
+// remote repository, replacing the root role that would otherwise be shipped
+// with the application. rootSHA256 is the hex encoded SHA-256 digest of the
+// current root.json, obtained out of band. The remote root must match the
+// digest and be signed by a threshold of its own keys, after which the rest of
+// the metadata is downloaded and verified as it would be by Update. Options
+// that configure transport, such as WithHTTPClient or WithCABundle, are
+// honored.
+func Bootstrap(settings *Settings, rootSHA256 string, opts ...Option) error {
+	client := newClient(opts...)
+	if settings.GUN == "" {
+		return errors.New("GUN can't be empty")
+	}
+	expected, err := hex.DecodeString(strings.TrimSpace(rootSHA256))
+	if err != nil || len(expected) != sha256.Size {
+		return errors.New("root digest must be a hex encoded SHA-256 hash")
+	}
+	if _, err := os.Stat(filepath.Join(settings.LocalRepoPath, "root.json")); err == nil {
+		return errAlreadyBootstrapped
+	}
+	if err := os.MkdirAll(settings.LocalRepoPath, 0755); err != nil {
+		return errors.Wrap(err, "creating local repository")
+	}
+	if err := client.configureTransport(); err != nil {
+		return errors.Wrap(err, "configuring http transport")
+	}
+	notary, _, err := client.remotes(settings)
+	if err != nil {
+		return err
+	}
+
+	root, err := pinnedRoot(notary, expected, client.sizeLimits.Root)
+	if err != nil {
+		return errors.Wrap(err, "bootstrapping root")
+	}
+	rm := newRepoMan(&bootstrapRepo{pinned: root}, notary, nil, settings, client.backupFileAge, client.clock)
+	rm.sizeLimits = client.sizeLimits
+	rm.logger = client.logger
+	tk, err := client.newTrustedClock(notary)
+	if err != nil {
+		return errors.Wrap(err, "creating trusted clock")
+	}
+	rm.useTrustedClock(tk)
+	if _, err := rm.refresh(); err != nil {
+		return errors.Wrap(err, "bootstrapping local repository")
+	}
+	return nil
+}
+
+// pinnedRoot downloads the current root role and checks it against a digest
+// that was distributed out of band.
+func pinnedRoot(notary remoteRepo, expected []byte, maxResponseSize int64) (*Root, error) {
+	body, err := notary.openRole(string(roleRoot))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var buff bytes.Buffer
+	if _, err := io.Copy(&buff, io.LimitReader(body, maxResponseSize)); err != nil {
+		return nil, errors.Wrap(err, "reading root")
+	}
+	sum := sha256.Sum256(buff.Bytes())
+	if subtle.ConstantTimeCompare(sum[:], expected) != 1 {
+		return nil, errRootDigestMismatch
+	}
+	var root Root
+	if err := json.Unmarshal(buff.Bytes(), &root); err != nil {
+		return nil, errors.Wrap(err, "decoding root")
+	}
+	root.setRaw(buff.Bytes())
+	return &root, nil
+}
+
+// bootstrapRepo stands in for the local repository while it is being created.
+// It holds the pinned root and reports no previous versions of the other
+// roles, so refresh accepts whatever the remote repository has as long as it
+// is signed by the pinned root.
+type bootstrapRepo struct {
+	pinned *Root
+}
+
+func (r *bootstrapRepo) root(opts ...repoOption) (*Root, error) {
+	return r.pinned, nil
+}
+
+func (r *bootstrapRepo) timestamp() (*Timestamp, error) {
+	return &Timestamp{}, nil
+}
+
+func (r *bootstrapRepo) snapshot(opts ...repoOption) (*Snapshot, error) {
+	return &Snapshot{}, nil
+}
+
+func (r *bootstrapRepo) targets(fetcher roleFetcher) (*RootTarget, error) {
+	return &RootTarget{
+		Targets:      &Targets{},
+		targetLookup: make(map[string]*Targets),
+		paths:        make(FimMap),
+	}, nil
+}
+
+func (r *bootstrapRepo) baseDir() string { return "" }
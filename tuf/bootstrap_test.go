@@ -0,0 +1,61 @@
+package tuf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBootstrap(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	k := clock.NewMockClock(testTime)
+	dir, err := ioutil.TempDir("", "bootstrap")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	notaryDir, mirrorDir := setupFileRepo(t, dir)
+	remoteRoot, err := ioutil.ReadFile(filepath.Join(notaryDir, "v2", filepath.FromSlash(testGUN), "_trust", "tuf", "root.json"))
+	require.NoError(t, err)
+	sum := sha256.Sum256(remoteRoot)
+
+	settings := &Settings{
+		LocalRepoPath: filepath.Join(dir, "local"),
+		NotaryURL:     fileURL(notaryDir),
+		MirrorURL:     fileURL(mirrorDir),
+		GUN:           testGUN,
+	}
+
+	// a root that doesn't match the pinned digest is rejected
+	wrong := sha256.Sum256([]byte("some other root"))
+	err = Bootstrap(settings, hex.EncodeToString(wrong[:]), withClock(k), WithFileURLs())
+	require.Error(t, err)
+	assert.Equal(t, errRootDigestMismatch, errors.Cause(err))
+	_, err = os.Stat(filepath.Join(settings.LocalRepoPath, "root.json"))
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, Bootstrap(settings, hex.EncodeToString(sum[:]), withClock(k), WithFileURLs()))
+	for _, role := range []string{"root", "timestamp", "snapshot", "targets"} {
+		_, err := os.Stat(filepath.Join(settings.LocalRepoPath, role+".json"))
+		assert.NoError(t, err, role)
+	}
+	err = Bootstrap(settings, hex.EncodeToString(sum[:]), withClock(k), WithFileURLs())
+	assert.Equal(t, errAlreadyBootstrapped, err)
+
+	// the bootstrapped repository can be used by a client
+	client, err := NewClient(settings, withClock(k), WithFileURLs())
+	require.NoError(t, err)
+	defer client.Stop()
+	targets, err := client.Targets()
+	require.NoError(t, err)
+	assert.Contains(t, targets, "edge/target")
+	_, _, err = client.Update()
+	require.NoError(t, err)
+}
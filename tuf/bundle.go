@@ -0,0 +1,461 @@
+package tuf
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// An update bundle contains everything needed to update a client that can't
+// reach Notary or a mirror. It is either a directory, for instance on a USB
+// drive, or a tar archive, optionally gzip compressed, with this layout:
+//
+//	bundle.json                 information about the bundle
+//	metadata/1.root.json        every version of the root role
+//	metadata/root.json          the current root role
+//	metadata/timestamp.json
+//	metadata/snapshot.json
+//	metadata/targets.json
+//	metadata/targets/...        delegated targets roles
+//	targets/...                 target files, by target name
+//
+// Roles are stored exactly as they were served by Notary, and are verified
+// the same way as roles downloaded from Notary.
+const (
+	bundleManifestName = "bundle.json"
+	bundleMetadataDir  = "metadata"
+	bundleTargetsDir   = "targets"
+)
+
+// bundleManifest identifies the repository a bundle was exported from.
+type bundleManifest struct {
+	GUN string `json:"gun"`
+}
+
+// WithBundle updates the client from an update bundle at bundlePath instead
+// of from Notary and a mirror, in which case the NotaryURL and MirrorURL
+// Settings are not used. The bundle is read each time an update is
+// performed, so it can be replaced while the client is running.
+func WithBundle(bundlePath string) Option {
+	return func(c *Client) {
+		c.bundlePath = bundlePath
+	}
+}
+
+// bundleRepo is a remote repository and mirror backed by an update bundle.
+type bundleRepo struct {
+	staticRepo
+	path string
+	gun  string
+}
+
+func newBundleRepo(bundlePath, gun string, sizeLimits SizeLimits) *bundleRepo {
+	b := &bundleRepo{path: bundlePath, gun: gun}
+	b.staticRepo = staticRepo{fetch: b.openRole, sizeLimits: sizeLimits}
+	return b
+}
+
+// Checks that the bundle is readable and was exported for our GUN.
+func (b *bundleRepo) ping() error {
+	rdr, err := b.openFile(bundleManifestName)
+	if err != nil {
+		return errors.Wrap(err, "reading bundle manifest")
+	}
+	defer rdr.Close()
+	var manifest bundleManifest
+	if err := json.NewDecoder(io.LimitReader(rdr, b.sizeLimits.Timestamp)).Decode(&manifest); err != nil {
+		return errors.Wrap(err, "decoding bundle manifest")
+	}
+	if manifest.GUN != b.gun {
+		return errors.Errorf("bundle is for %q, expected %q", manifest.GUN, b.gun)
+	}
+	return nil
+}
+
+func (b *bundleRepo) openRole(roleName string) (io.ReadCloser, error) {
+	return b.openFile(path.Join(bundleMetadataDir, roleName+".json"))
+}
+
+func (b *bundleRepo) open(_ context.Context, target string) (io.ReadCloser, error) {
+	return b.openFile(path.Join(bundleTargetsDir, target))
+}
+
+// openFile returns the contents of a file in the bundle, name is a slash
+// separated path relative to the root of the bundle. Returns errNotFound if
+// the file does not exist.
+func (b *bundleRepo) openFile(name string) (io.ReadCloser, error) {
+	name = path.Clean(name)
+	if _, err := localFileName(name); err != nil {
+		return nil, errors.Wrap(err, "opening bundle")
+	}
+	fi, err := os.Stat(b.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening bundle")
+	}
+	if fi.IsDir() {
+		return openLocalFile(filepath.Join(b.path, filepath.FromSlash(name)))
+	}
+	return openArchiveEntry(b.path, name)
+}
+
+// archiveEntry reads a single file from a tar archive.
+type archiveEntry struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (e *archiveEntry) Close() error {
+	var err error
+	for i := len(e.closers) - 1; i >= 0; i-- {
+		if cerr := e.closers[i].Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func openArchiveEntry(archivePath, name string) (io.ReadCloser, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening bundle archive")
+	}
+	entry := &archiveEntry{closers: []io.Closer{f}}
+	var rdr io.Reader = f
+	if strings.HasSuffix(archivePath, ".gz") || strings.HasSuffix(archivePath, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			entry.Close()
+			return nil, errors.Wrap(err, "reading compressed bundle")
+		}
+		entry.closers = append(entry.closers, gz)
+		rdr = gz
+	}
+	tr := tar.NewReader(rdr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			entry.Close()
+			return nil, errNotFound
+		}
+		if err != nil {
+			entry.Close()
+			return nil, errors.Wrap(err, "reading bundle archive")
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if path.Clean(hdr.Name) == name {
+			entry.Reader = tr
+			return entry, nil
+		}
+	}
+}
+
+// ExportBundle writes a gzip compressed update bundle to w containing the
+// verified metadata from Notary and the named targets. If no targets are
+// named, every target is included. ExportBundle performs an Update first so
+// that the bundle is exported from verified, current metadata. If the update
+// fails, for example because Notary can't be reached, the metadata in the
+// local repository is verified and exported instead, with only the current
+// version of the root role.
+func (c *Client) ExportBundle(w io.Writer, targets ...string) error {
+	resultC := make(chan error)
+	c.jobs <- func(rm *repoMan) {
+		resultC <- rm.exportBundle(w, targets)
+	}
+	return <-resultC
+}
+
+func (rs *repoMan) exportBundle(w io.Writer, targets []string) error {
+	online := true
+	if _, err := rs.refresh(); err != nil {
+		level.Info(rs.logger).Log(
+			"msg", "exporting bundle from local repository",
+			"err", err,
+		)
+		if lerr := rs.loadLocalRoles(); lerr != nil {
+			return errors.Wrapf(lerr, "updating before export failed with %q, using local repository", err)
+		}
+		online = false
+	}
+	if len(targets) == 0 {
+		for name := range rs.targets.paths {
+			targets = append(targets, name)
+		}
+		sort.Strings(targets)
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.Marshal(bundleManifest{GUN: rs.settings.GUN})
+	if err != nil {
+		return errors.Wrap(err, "encoding bundle manifest")
+	}
+	if err := writeBundleFile(tw, bundleManifestName, manifest); err != nil {
+		return err
+	}
+	// Every version of the root role is included so that a client with any
+	// previous root can establish trust in the current one.
+	roots, err := rs.readRootChain(online)
+	if err != nil {
+		return err
+	}
+	for i := len(roots) - 1; i >= 0; i-- {
+		name := fmt.Sprintf("%d.%s.json", rs.root.Signed.Version-i, roleRoot)
+		if err := writeBundleFile(tw, path.Join(bundleMetadataDir, name), roots[i]); err != nil {
+			return err
+		}
+	}
+	roles := []string{string(roleRoot), string(roleTimestamp), string(roleSnapshot)}
+	for _, delegate := range rs.targets.targetPrecedence {
+		roles = append(roles, delegate.delegateRole)
+	}
+	for _, roleName := range roles {
+		buff, err := rs.readRawRole(roleName)
+		if err != nil {
+			return errors.Wrapf(err, "reading role %q for export", roleName)
+		}
+		if err := rs.verifyRawRole(roleName, buff); err != nil {
+			return errors.Wrapf(err, "verifying role %q for export", roleName)
+		}
+		if err := writeBundleFile(tw, path.Join(bundleMetadataDir, roleName+".json"), buff); err != nil {
+			return err
+		}
+	}
+	for _, target := range targets {
+		if err := rs.exportTarget(tw, target); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return errors.Wrap(err, "closing bundle archive")
+	}
+	return gz.Close()
+}
+
+// loadLocalRoles verifies the roles in the local repository and uses them in
+// place of the roles from the last refresh.
+func (rs *repoMan) loadLocalRoles() error {
+	if err := verifyLocalRepo(rs.repo.baseDir()); err != nil {
+		return errors.Wrap(err, "verifying local repository")
+	}
+	root, err := rs.repo.root()
+	if err != nil {
+		return err
+	}
+	timestamp, err := rs.repo.timestamp()
+	if err != nil {
+		return err
+	}
+	snapshot, err := rs.repo.snapshot()
+	if err != nil {
+		return err
+	}
+	targets, err := rs.repo.targets(&localTargetFetcher{rs.repo.baseDir()})
+	if err != nil {
+		return err
+	}
+	rs.root, rs.timestamp, rs.snapshot, rs.targets = root, timestamp, snapshot, targets
+	return nil
+}
+
+// readRawRole returns a role from the local repository. Roles are saved
+// exactly as they were served by Notary, so they match the hashes in their
+// parent roles.
+func (rs *repoMan) readRawRole(roleName string) ([]byte, error) {
+	name, err := localFileName(roleName + ".json")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(rs.repo.baseDir(), name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return rs.readLimitedRole(roleName, f)
+}
+
+// readNotaryRole returns a role exactly as it is served by Notary, for roles
+// such as previous versions of the root that aren't kept locally.
+func (rs *repoMan) readNotaryRole(roleName string) ([]byte, error) {
+	body, err := rs.notary.openRole(roleName)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return rs.readLimitedRole(roleName, body)
+}
+
+// readLimitedRole reads a role, failing if it is over the size limit for the
+// role rather than truncating it.
+func (rs *repoMan) readLimitedRole(roleName string, body io.Reader) ([]byte, error) {
+	limit := rs.sizeLimits.forRole(roleName)
+	buff, err := ioutil.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buff)) > limit {
+		return nil, errors.Errorf("role %q is larger than %d bytes", roleName, limit)
+	}
+	return buff, nil
+}
+
+// readRootChain returns the served versions of the root role, newest first,
+// starting with the verified current root from the local repository. Older
+// versions are only kept by Notary, so they are only included if online. Each
+// older version must have signed the version after it, so the chain stops at
+// the first version that isn't available because nothing older can be linked
+// to the current root.
+func (rs *repoMan) readRootChain(online bool) ([][]byte, error) {
+	var roots [][]byte
+	next := rs.root
+	for version := rs.root.Signed.Version; version > 0; version-- {
+		roleName := fmt.Sprintf("%d.%s", version, roleRoot)
+		var (
+			buff []byte
+			err  error
+		)
+		if version == rs.root.Signed.Version {
+			buff, err = rs.readRawRole(string(roleRoot))
+		} else if !online {
+			break
+		} else if buff, err = rs.readNotaryRole(roleName); err == errNotFound {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading role %q for export", roleName)
+		}
+		var root Root
+		if err := json.Unmarshal(buff, &root); err != nil {
+			return nil, errors.Wrapf(err, "decoding role %q for export", roleName)
+		}
+		if version == rs.root.Signed.Version {
+			err = sameSigned(root.Signed, rs.root.Signed)
+		} else if root.Signed.Version != version {
+			err = errVersionIncorrect
+		} else {
+			err = verifySignatures(next.Signed, keymapForSignatures(&root), next.Signatures, root.Signed.Roles[roleRoot].Threshold)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "verifying role %q for export", roleName)
+		}
+		roots = append(roots, buff)
+		next = &root
+	}
+	return roots, nil
+}
+
+// verifyRawRole checks that a role read for export is the one verified by
+// the last refresh. The snapshot and targets roles are checked against the
+// hashes and length in their parent metadata, and root and timestamp must
+// contain the same signed metadata.
+func (rs *repoMan) verifyRawRole(roleName string, buff []byte) error {
+	switch roleName {
+	case string(roleRoot):
+		var root Root
+		if err := json.Unmarshal(buff, &root); err != nil {
+			return errors.Wrap(err, "decoding root")
+		}
+		return sameSigned(root.Signed, rs.root.Signed)
+	case string(roleTimestamp):
+		var timestamp Timestamp
+		if err := json.Unmarshal(buff, &timestamp); err != nil {
+			return errors.Wrap(err, "decoding timestamp")
+		}
+		return sameSigned(timestamp.Signed, rs.timestamp.Signed)
+	case string(roleSnapshot):
+		fim, ok := rs.timestamp.Signed.Meta[roleSnapshot]
+		if !ok {
+			return errors.New("expected snapshot metadata was missing from timestamp role")
+		}
+		return fim.verifyRole(bytes.NewReader(buff))
+	default:
+		fim, ok := rs.snapshot.Signed.Meta[role(roleName)]
+		if !ok {
+			return errors.Errorf("fim data missing for %q", roleName)
+		}
+		return fim.verifyRole(bytes.NewReader(buff))
+	}
+}
+
+// sameSigned returns an error unless the canonical encodings of two signed
+// portions of a role are identical.
+func sameSigned(signed, verified marshaller) error {
+	a, err := signed.canonicalJSON()
+	if err != nil {
+		return errors.Wrap(err, "encoding role")
+	}
+	b, err := verified.canonicalJSON()
+	if err != nil {
+		return errors.Wrap(err, "encoding role")
+	}
+	if !bytes.Equal(a, b) {
+		return errors.New("role does not match verified metadata")
+	}
+	return nil
+}
+
+// exportTarget downloads and verifies a target before adding it to the
+// bundle, because the size of each file must be known before it is written.
+func (rs *repoMan) exportTarget(tw *tar.Writer, target string) error {
+	tmp, err := ioutil.TempFile("", "bundle")
+	if err != nil {
+		return errors.Wrap(err, "creating temporary file for export")
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	if err := rs.downloadTarget(target, tmp); err != nil {
+		return errors.Wrapf(err, "downloading %q for export", target)
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Wrap(err, "exporting target")
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "exporting target")
+	}
+	hdr := &tar.Header{
+		Name:     path.Join(bundleTargetsDir, target),
+		Mode:     0644,
+		Size:     size,
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return errors.Wrapf(err, "writing %q to bundle", target)
+	}
+	if _, err := io.Copy(tw, tmp); err != nil {
+		return errors.Wrapf(err, "writing %q to bundle", target)
+	}
+	return nil
+}
+
+func writeBundleFile(tw *tar.Writer, name string, buff []byte) error {
+	hdr := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(buff)),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return errors.Wrapf(err, "writing %q to bundle", name)
+	}
+	if _, err := tw.Write(buff); err != nil {
+		return errors.Wrapf(err, "writing %q to bundle", name)
+	}
+	return nil
+}
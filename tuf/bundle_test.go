@@ -0,0 +1,226 @@
+package tuf
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/kolide/updater/tuf/authoring"
+	"github.com/kolide/updater/tuf/tuftest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exportTestBundle exports a bundle from the version 2 test repository and
+// returns the path of the bundle archive.
+func exportTestBundle(t *testing.T, dir string, k clock.Clock) string {
+	settings, _, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	client, err := NewClient(settings, WithHTTPClient(testHTTPClient()), withClock(k))
+	require.NoError(t, err)
+	defer client.Stop()
+
+	bundlePath := filepath.Join(dir, "bundle.tar.gz")
+	f, err := os.Create(bundlePath)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, client.ExportBundle(f, "edge/target"))
+	return bundlePath
+}
+
+// unpackTestBundle extracts a bundle archive into a directory the way it might
+// be copied to a USB drive.
+func unpackTestBundle(t *testing.T, bundlePath, dir string) {
+	f, err := os.Open(bundlePath)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return
+		}
+		require.NoError(t, err)
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(target), 0755))
+		buff, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(target, buff, 0644))
+	}
+}
+
+func offlineSettings(t *testing.T, localVersion int) *Settings {
+	localRepoDir, err := ioutil.TempDir("", "local")
+	require.NoError(t, err)
+	createLocalTestRepo(t, localRepoDir, path.Join(assetRoot, strconv.Itoa(localVersion)))
+	return &Settings{
+		LocalRepoPath: localRepoDir,
+		GUN:           testGUN,
+	}
+}
+
+func TestBundle(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	k := clock.NewMockClock(testTime)
+	dir, err := ioutil.TempDir("", "bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	bundlePath := exportTestBundle(t, dir, k)
+	bundleDir := filepath.Join(dir, "usb")
+	unpackTestBundle(t, bundlePath, bundleDir)
+	expected := testAsset(t, path.Join(mirrorRoot, "2", "edge", "target"))
+
+	for _, location := range []string{bundlePath, bundleDir} {
+		t.Run(filepath.Base(location), func(t *testing.T) {
+			settings := offlineSettings(t, 1)
+			defer os.RemoveAll(settings.LocalRepoPath)
+			client, err := NewClient(settings, withClock(k), WithBundle(location))
+			require.NoError(t, err)
+			defer client.Stop()
+
+			_, latest, err := client.Update()
+			require.NoError(t, err)
+			assert.False(t, latest)
+			var buff bytes.Buffer
+			require.NoError(t, client.Download("edge/target", &buff))
+			assert.Equal(t, expected, buff.Bytes())
+			// targets that weren't exported are not available
+			assert.Error(t, client.Download("latest/target", ioutil.Discard))
+		})
+	}
+}
+
+func TestBundleAutoupdate(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	k := clock.NewMockClock(testTime)
+	dir, err := ioutil.TempDir("", "bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bundlePath := exportTestBundle(t, dir, k)
+
+	settings := offlineSettings(t, 1)
+	defer os.RemoveAll(settings.LocalRepoPath)
+	var (
+		stagingPath string
+		cbErr       error
+	)
+	onUpdate := func(p string, err error) {
+		stagingPath = p
+		cbErr = err
+	}
+	client, err := NewClient(
+		settings,
+		withClock(k),
+		WithBundle(bundlePath),
+		WithAutoUpdate("edge/target", filepath.Join(dir, "staging"), onUpdate),
+	)
+	require.NoError(t, err)
+	client.Stop()
+	require.NoError(t, cbErr)
+	assert.Equal(t, filepath.Join(dir, "staging", "edge", "target"), stagingPath)
+}
+
+func TestBundleVerification(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	k := clock.NewMockClock(testTime)
+	dir, err := ioutil.TempDir("", "bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bundleDir := filepath.Join(dir, "usb")
+	unpackTestBundle(t, exportTestBundle(t, dir, k), bundleDir)
+
+	settings := offlineSettings(t, 1)
+	defer os.RemoveAll(settings.LocalRepoPath)
+
+	// the bundle must be for our GUN
+	_, err = NewClient(&Settings{LocalRepoPath: settings.LocalRepoPath, GUN: "kolide/other"}, withClock(k), WithBundle(bundleDir))
+	require.Error(t, err)
+
+	// a tampered target fails verification
+	targetPath := filepath.Join(bundleDir, bundleTargetsDir, "edge", "target")
+	buff, err := ioutil.ReadFile(targetPath)
+	require.NoError(t, err)
+	buff[0]++
+	require.NoError(t, ioutil.WriteFile(targetPath, buff, 0644))
+	client, err := NewClient(settings, withClock(k), WithBundle(bundleDir))
+	require.NoError(t, err)
+	_, _, err = client.Update()
+	require.NoError(t, err)
+	assert.Error(t, client.Download("edge/target", ioutil.Discard))
+	client.Stop()
+
+	// tampered metadata is rejected
+	snapshotPath := filepath.Join(bundleDir, bundleMetadataDir, "snapshot.json")
+	buff, err = ioutil.ReadFile(snapshotPath)
+	require.NoError(t, err)
+	buff = bytes.Replace(buff, []byte(`"version":`), []byte(`"version":1`), 1)
+	require.NoError(t, ioutil.WriteFile(snapshotPath, buff, 0644))
+	client, err = NewClient(settings, withClock(k), WithBundle(bundleDir))
+	require.NoError(t, err)
+	_, _, err = client.Update()
+	assert.Error(t, err)
+	client.Stop()
+}
+
+func TestExportBundleVerifiesRoles(t *testing.T) {
+	f, cleanup := setupAttack(t)
+	defer cleanup()
+	targets, _ := f.server.Role(authoring.RoleTargets)
+
+	client := f.newClient(t)
+	require.NoError(t, client.ExportBundle(ioutil.Discard))
+	client.Stop()
+
+	// without notary the verified local repository is exported
+	dir, err := ioutil.TempDir("", "bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	f.server.SetRoleFault(authoring.RoleTimestamp, tuftest.StatusFault(http.StatusServiceUnavailable))
+	bundlePath := filepath.Join(dir, "bundle.tar.gz")
+	bundle, err := os.Create(bundlePath)
+	require.NoError(t, err)
+	client = f.newClient(t)
+	require.NoError(t, client.ExportBundle(bundle))
+	client.Stop()
+	require.NoError(t, bundle.Close())
+
+	local := filepath.Join(dir, "local")
+	require.NoError(t, f.server.WriteLocalRepo(local))
+	offline, err := NewClient(&Settings{LocalRepoPath: local, GUN: testGUN}, withClock(f.clock), WithBundle(bundlePath), loadOnStart(false))
+	require.NoError(t, err)
+	defer offline.Stop()
+	_, _, err = offline.Update()
+	require.NoError(t, err)
+	var buff bytes.Buffer
+	require.NoError(t, offline.Download("edge/target", &buff))
+	assert.Equal(t, f.genuine, buff.Bytes())
+
+	// local roles that don't match their parents aren't exported
+	targetsPath := filepath.Join(f.local, authoring.RoleTargets+".json")
+	require.NoError(t, ioutil.WriteFile(targetsPath, append(targets, '\n'), 0644))
+	client = f.newClient(t)
+	err = client.ExportBundle(ioutil.Discard)
+	client.Stop()
+	require.Error(t, err)
+	assert.Equal(t, errLengthIncorrect, errors.Cause(err))
+
+	// roles over the size limit are rejected rather than truncated
+	require.NoError(t, ioutil.WriteFile(targetsPath, targets, 0644))
+	client = f.newClient(t, WithSizeLimits(SizeLimits{Targets: int64(len(targets) - 1)}))
+	defer client.Stop()
+	assert.Error(t, client.ExportBundle(ioutil.Discard))
+}
@@ -0,0 +1,191 @@
+package tuf
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/pkg/errors"
+)
+
+// WithCache keeps downloaded targets in dir, named by their hash, so that a
+// target is only downloaded once even if it appears under several target
+// names or is downloaded again after a rollback. Cached targets are verified
+// again each time they are used. When maxSize is more than zero the least
+// recently used targets are removed to keep the cache below maxSize bytes,
+// and when maxAge is more than zero targets which haven't been used for
+// maxAge are removed.
+func WithCache(dir string, maxSize int64, maxAge time.Duration) Option {
+	return func(c *Client) {
+		c.cache = &targetCache{
+			dir:     dir,
+			maxSize: maxSize,
+			maxAge:  maxAge,
+		}
+	}
+}
+
+const cacheTempPrefix = ".download"
+
+// targetCache is a content addressed store of verified targets. The
+// modification time of each entry is the last time it was used.
+type targetCache struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+	clock   clock.Clock
+}
+
+// key returns the file name for a target, using the strongest hash in fim.
+func (tc *targetCache) key(fim FileIntegrityMeta) (string, error) {
+	for _, algo := range []hashingMethod{hashSHA512, hashSHA256} {
+		encoded, ok := fim.Hashes[algo]
+		if !ok {
+			continue
+		}
+		sum, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", errors.Wrap(err, "decoding target hash")
+		}
+		return string(algo) + "-" + hex.EncodeToString(sum), nil
+	}
+	return "", errors.New("target has no supported hash")
+}
+
+// copyTo writes a cached copy of the target described by fim to destination
+// after verifying it. It returns false if there isn't a valid cached copy, in
+// which case nothing is written. A cached copy which fails verification is
+// removed.
+func (tc *targetCache) copyTo(fim FileIntegrityMeta, destination io.Writer) (bool, error) {
+	key, err := tc.key(fim)
+	if err != nil {
+		return false, nil
+	}
+	name := filepath.Join(tc.dir, key)
+	f, err := os.Open(name)
+	if err != nil {
+		return false, nil
+	}
+	defer f.Close()
+	if err := fim.verify(f); err != nil {
+		f.Close()
+		os.Remove(name)
+		return false, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false, nil
+	}
+	now := tc.clock.Now()
+	os.Chtimes(name, now, now)
+	if _, err := io.Copy(destination, f); err != nil {
+		return true, errors.Wrap(err, "copying cached target")
+	}
+	return true, nil
+}
+
+// cacheEntry is a target being added to the cache while it is downloaded.
+// Writes always succeed so that a full disk or an unwritable cache doesn't
+// interrupt the download, the first error is kept and returned by commit.
+type cacheEntry struct {
+	f     *os.File
+	cache *targetCache
+	err   error
+}
+
+func (tc *targetCache) create() (*cacheEntry, error) {
+	if err := os.MkdirAll(tc.dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "creating cache directory")
+	}
+	f, err := ioutil.TempFile(tc.dir, cacheTempPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating cache entry")
+	}
+	return &cacheEntry{f: f, cache: tc}, nil
+}
+
+func (e *cacheEntry) Write(p []byte) (int, error) {
+	if e.err == nil {
+		_, e.err = e.f.Write(p)
+	}
+	return len(p), nil
+}
+
+// commit adds the entry to the cache once the download has been verified
+// against fim.
+func (e *cacheEntry) commit(fim FileIntegrityMeta) error {
+	if e.err != nil {
+		e.abort()
+		return errors.Wrap(e.err, "writing cache entry")
+	}
+	if err := e.f.Close(); err != nil {
+		os.Remove(e.f.Name())
+		return errors.Wrap(err, "closing cache entry")
+	}
+	key, err := e.cache.key(fim)
+	if err != nil {
+		os.Remove(e.f.Name())
+		return err
+	}
+	now := e.cache.clock.Now()
+	os.Chtimes(e.f.Name(), now, now)
+	if err := os.Rename(e.f.Name(), filepath.Join(e.cache.dir, key)); err != nil {
+		os.Remove(e.f.Name())
+		return errors.Wrap(err, "saving cache entry")
+	}
+	return nil
+}
+
+func (e *cacheEntry) abort() {
+	e.f.Close()
+	os.Remove(e.f.Name())
+}
+
+// evict removes entries that haven't been used for maxAge, then removes the
+// least recently used entries until the cache is no larger than maxSize.
+func (tc *targetCache) evict() error {
+	infos, err := ioutil.ReadDir(tc.dir)
+	if err != nil {
+		return errors.Wrap(err, "reading cache directory")
+	}
+	var (
+		entries []os.FileInfo
+		size    int64
+	)
+	now := tc.clock.Now()
+	for _, fi := range infos {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), cacheTempPrefix) {
+			continue
+		}
+		if tc.maxAge > 0 && now.Sub(fi.ModTime()) > tc.maxAge {
+			if err := os.Remove(filepath.Join(tc.dir, fi.Name())); err != nil {
+				return errors.Wrap(err, "removing expired cache entry")
+			}
+			continue
+		}
+		entries = append(entries, fi)
+		size += fi.Size()
+	}
+	if tc.maxSize <= 0 {
+		return nil
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().Before(entries[j].ModTime())
+	})
+	for _, fi := range entries {
+		if size <= tc.maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(tc.dir, fi.Name())); err != nil {
+			return errors.Wrap(err, "removing cache entry")
+		}
+		size -= fi.Size()
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package tuf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingRoundTripper counts requests for targets.
+type countingRoundTripper struct {
+	proxied http.RoundTripper
+	count   *int32
+}
+
+func (crt countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(req.URL.Path, "edge/target") {
+		atomic.AddInt32(crt.count, 1)
+	}
+	return crt.proxied.RoundTrip(req)
+}
+
+func TestCachedDownload(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	settings, _, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	cacheDir, err := ioutil.TempDir("", "cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+	expected := testAsset(t, path.Join(mirrorRoot, "2", "edge", "target"))
+
+	var downloads int32
+	httpClient := testHTTPClient()
+	httpClient.Transport = countingRoundTripper{proxied: httpClient.Transport, count: &downloads}
+	client, err := NewClient(settings, WithHTTPClient(httpClient), withClock(clock.NewMockClock(testTime)), WithCache(cacheDir, 0, 0))
+	require.NoError(t, err)
+	defer client.Stop()
+	_, _, err = client.Update()
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		var buff bytes.Buffer
+		require.NoError(t, client.Download("edge/target", &buff))
+		assert.Equal(t, expected, buff.Bytes())
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&downloads))
+
+	// a cached target that has been altered is downloaded again
+	entries, err := ioutil.ReadDir(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.True(t, strings.HasPrefix(entries[0].Name(), "sha512-"))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(cacheDir, entries[0].Name()), []byte("altered"), 0644))
+	var buff bytes.Buffer
+	require.NoError(t, client.Download("edge/target", &buff))
+	assert.Equal(t, expected, buff.Bytes())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&downloads))
+
+	// failing to cache a target doesn't fail the download
+	name := filepath.Join(cacheDir, entries[0].Name())
+	require.NoError(t, os.Remove(name))
+	require.NoError(t, os.MkdirAll(filepath.Join(name, "blocked"), 0755))
+	buff.Reset()
+	require.NoError(t, client.Download("edge/target", &buff))
+	assert.Equal(t, expected, buff.Bytes())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&downloads))
+}
+
+func TestCacheEntryWriteFailure(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+	tc := &targetCache{dir: cacheDir, clock: clock.NewMockClock(time.Now())}
+
+	entry, err := tc.create()
+	require.NoError(t, err)
+	require.NoError(t, entry.f.Close())
+	// the download continues even though the entry can't be written
+	n, err := entry.Write([]byte("content"))
+	require.NoError(t, err)
+	assert.Equal(t, 7, n)
+	assert.Error(t, entry.commit(testFIM([]byte("content"))))
+	entries, err := ioutil.ReadDir(cacheDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestCacheEviction(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	k := clock.NewMockClock(testTime)
+	cacheDir, err := ioutil.TempDir("", "cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+	tc := &targetCache{dir: cacheDir, maxSize: 10, maxAge: time.Hour, clock: k}
+
+	add := func(content string) FileIntegrityMeta {
+		fim := testFIM([]byte(content))
+		entry, err := tc.create()
+		require.NoError(t, err)
+		_, err = entry.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, entry.commit(fim))
+		require.NoError(t, tc.evict())
+		k.AddTime(time.Minute)
+		return fim
+	}
+	cached := func(fim FileIntegrityMeta) bool {
+		ok, err := tc.copyTo(fim, ioutil.Discard)
+		require.NoError(t, err)
+		return ok
+	}
+
+	first := add("aaaa")
+	second := add("bbbb")
+	// using the first entry makes the second the least recently used
+	assert.True(t, cached(first))
+	third := add("cccc")
+	assert.True(t, cached(first))
+	assert.False(t, cached(second))
+	assert.True(t, cached(third))
+
+	k.AddTime(2 * time.Hour)
+	add("dd")
+	assert.False(t, cached(first))
+	assert.False(t, cached(third))
+}
@@ -2,9 +2,9 @@ package tuf
 
 import (
 	"io"
+	"net"
 	"net/http"
 	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
@@ -21,11 +21,34 @@ type Client struct {
 	backupFileAge       time.Duration
 	watchedTarget       string
 	stagingPath         string
+	installer           *Installer
+	autoupdate          *autoupdater
 	notificationHandler NotificationHandler
+	healthCheck         HealthCheck
+	healthCheckTimeout  time.Duration
 	quit                chan struct{}
 	clock               clock.Clock
 	client              *http.Client
-	maxResponseSize     int64
+	sizeLimits          SizeLimits
+	bundlePath          string
+	allowFileURLs       bool
+	newMirrorTransport  func(*Client) (MirrorTransport, error)
+	tls                 tlsOptions
+	notaryAuth          CredentialProvider
+	proxyURL            string
+	bandwidthLimit      int64
+	downloadWindow      *DownloadWindow
+	progress            ProgressHandler
+	cache               *targetCache
+	decompressors       map[string]Decompressor
+	extractArchive      bool
+	archiveManifest     string
+	metadataDeadline    time.Duration
+	targetDeadline      time.Duration
+	minThroughput       int64
+	throughputWindow    time.Duration
+	timeSource          TimeSource
+	notaryTime          bool
 	jobs                chan func(*repoMan)
 	wait                sync.WaitGroup
 	logger              log.Logger
@@ -74,6 +97,8 @@ func WithLogger(logger log.Logger) Option {
 type NotificationHandler func(stagingPath string, err error)
 
 // WithAutoUpdate specifies a target which will be auto-downloaded into a staging path by the client.
+// New versions are installed atomically and the version they replace is kept, see Installer and
+// Client.Rollback.
 // WithAutoUpdate requires a NotificationHandler which will be called whenever there is a new upate.
 // Use WithFrequency to configure how often the autoupdate goroutine runs.
 // There can only be one NotificationHandler per Client.
@@ -99,24 +124,16 @@ func WithHTTPClient(httpClient *http.Client) Option {
 //
 // You can use one of the provided Options to customize the client configuration.
 func NewClient(settings *Settings, opts ...Option) (*Client, error) {
+	client := newClient(opts...)
 	if err := settings.verify(); err != nil {
 		return nil, err
 	}
-
-	client := Client{
-		maxResponseSize: defaultMaxResponseSize,
-		client:          defaultHttpClient(),
-		checkFrequency:  defaultCheckFrequency,
-		backupFileAge:   defaultBackupAge,
-		quit:            make(chan struct{}),
-		clock:           &clock.DefaultClock{},
-		jobs:            make(chan func(*repoMan)),
-		loadOnStart:     true,
-		forceAutoUpdate: make(chan struct{}),
-		logger:          log.NewNopLogger(),
+	if err := client.configureTransport(); err != nil {
+		return nil, errors.Wrap(err, "configuring http transport")
 	}
-	for _, opt := range opts {
-		opt(&client)
+	// Throttled downloads can't be faster than the bandwidth limit.
+	if client.bandwidthLimit > 0 && client.minThroughput >= client.bandwidthLimit {
+		client.minThroughput = client.bandwidthLimit / 2
 	}
 
 	level.Debug(client.logger).Log(
@@ -124,9 +141,9 @@ func NewClient(settings *Settings, opts ...Option) (*Client, error) {
 		"GUN", settings.GUN,
 	)
 
-	notary, err := newNotaryRepo(settings, client.maxResponseSize, client.client)
+	notary, targetMirror, err := client.remotes(settings)
 	if err != nil {
-		return nil, errors.Wrap(err, "creating notary client")
+		return nil, err
 	}
 	err = notary.ping()
 	if err != nil {
@@ -137,23 +154,57 @@ func NewClient(settings *Settings, opts ...Option) (*Client, error) {
 		return nil, errors.New("creating local tuf role repo")
 	}
 
-	rm := newRepoMan(localRepo, notary, settings, notary.client, client.backupFileAge, client.clock)
+	rm := newRepoMan(localRepo, notary, targetMirror, settings, client.backupFileAge, client.clock)
+	rm.bandwidthLimit = client.bandwidthLimit
+	rm.progress = client.progress
+	rm.decompressors = client.decompressors
+	rm.targetLimits = client.retrievalLimits(client.targetDeadline)
+	rm.sizeLimits = client.sizeLimits
+	rm.logger = client.logger
+	tk, err := client.newTrustedClock(notary)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating trusted clock")
+	}
+	rm.useTrustedClock(tk)
+	if client.cache != nil {
+		client.cache.clock = client.clock
+		rm.cache = client.cache
+	}
 	var autoupdate *autoupdater
 	if client.watchedTarget != "" {
 		if client.notificationHandler == nil {
 			return nil, errors.New("notification handler required for autoupdate")
 		}
-		// Initialize with file integrity info on the target we are watching from
-		// the validated local TUF repository.
-		validatedTargets, err := localRepo.targets(&localTargetFetcher{localRepo.baseDir()})
+		client.installer = NewInstaller(client.stagingPath)
+		state, err := loadAutoupdateState(client.stagingPath)
 		if err != nil {
 			return nil, errors.Wrap(err, "creating tuf client")
 		}
-		fim, ok := validatedTargets.paths[client.watchedTarget]
+		// Initialize with file integrity info on the target that was last
+		// delivered. If that wasn't recorded, for example the first time we
+		// run, use the target we are watching from the validated local TUF
+		// repository, but only if it is the one in the staging path. Otherwise
+		// the target is delivered by the first update.
+		fim, ok := state.Delivered[client.watchedTarget]
 		if !ok {
-			return nil, errors.Errorf("target %q does not exist", client.watchedTarget)
+			validatedTargets, err := localRepo.targets(&localTargetFetcher{localRepo.baseDir()})
+			if err != nil {
+				return nil, errors.Wrap(err, "creating tuf client")
+			}
+			trusted, ok := validatedTargets.paths[client.watchedTarget]
+			if !ok {
+				return nil, errors.Errorf("target %q does not exist", client.watchedTarget)
+			}
+			if verifyFile(client.watchedTarget, trusted, client.installer.Path(client.watchedTarget)) == nil {
+				fim = trusted
+				state.Delivered[client.watchedTarget] = fim
+				if err := state.save(); err != nil {
+					return nil, errors.Wrap(err, "creating tuf client")
+				}
+			}
 		}
-		autoupdate = newAutoupdater(&client, fim)
+		autoupdate = newAutoupdater(client, fim, state)
+		client.autoupdate = autoupdate
 	}
 	ticker := client.clock.NewTicker(client.checkFrequency).Chan()
 	client.wait.Add(1)
@@ -172,7 +223,71 @@ func NewClient(settings *Settings, opts ...Option) (*Client, error) {
 		client.forceAutoUpdate <- struct{}{}
 	}
 
-	return &client, nil
+	return client, nil
+}
+
+// newClient returns a Client with default settings and opts applied.
+func newClient(opts ...Option) *Client {
+	client := &Client{
+		sizeLimits:       defaultSizeLimits,
+		client:           defaultHttpClient(),
+		checkFrequency:   defaultCheckFrequency,
+		backupFileAge:    defaultBackupAge,
+		quit:             make(chan struct{}),
+		clock:            &clock.DefaultClock{},
+		jobs:             make(chan func(*repoMan)),
+		loadOnStart:      true,
+		forceAutoUpdate:  make(chan struct{}),
+		logger:           log.NewNopLogger(),
+		decompressors:    defaultDecompressors(),
+		metadataDeadline: defaultMetadataDeadline,
+		minThroughput:    defaultMinThroughput,
+		throughputWindow: defaultThroughputWindow,
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	return client
+}
+
+// remotes creates the repository that TUF metadata is downloaded from, and
+// the mirror that targets are downloaded from.
+func (c *Client) remotes(settings *Settings) (remoteRepo, mirror, error) {
+	if c.bundlePath != "" {
+		bundle := newBundleRepo(c.bundlePath, settings.GUN, c.sizeLimits)
+		return bundle, bundle, nil
+	}
+	var (
+		notary       remoteRepo
+		targetMirror mirror
+		err          error
+	)
+	if c.allowFileURLs && isFileURL(settings.NotaryURL) {
+		notary, err = newFileRepo(settings, c.sizeLimits)
+	} else {
+		var nr *notaryRepo
+		nr, err = newNotaryRepo(settings, c.sizeLimits, c.notaryClient())
+		if err == nil {
+			nr.limits = c.retrievalLimits(c.metadataDeadline)
+			notary = nr
+		}
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "creating notary client")
+	}
+	if c.newMirrorTransport != nil {
+		var transport MirrorTransport
+		transport, err = c.newMirrorTransport(c)
+		targetMirror = &transportMirror{transport: transport, gun: settings.GUN}
+	} else if c.allowFileURLs && isFileURL(settings.MirrorURL) {
+		targetMirror, err = newFileMirror(settings)
+	} else {
+		targetMirror, err = newHTTPSMirror(settings, c.client)
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "creating mirror client")
+	}
+	return notary, targetMirror, nil
 }
 
 // Update updates the local TUF metadata from a remote repository. If the update is successful,
@@ -208,8 +323,31 @@ func (c *Client) Update() (files FimMap, latest bool, err error) {
 	return result.files, result.latest, result.err
 }
 
+// Targets returns the targets in the trusted metadata. If Update has not been
+// called the metadata in the local repository is used.
+func (c *Client) Targets() (FimMap, error) {
+	type resultTargets struct {
+		files FimMap
+		err   error
+	}
+	resultC := make(chan resultTargets)
+	c.jobs <- func(rm *repoMan) {
+		targets, err := rm.trustedTargets()
+		if err != nil {
+			resultC <- resultTargets{nil, err}
+			return
+		}
+		resultC <- resultTargets{targets.paths.clone(), nil}
+	}
+	result := <-resultC
+	return result.files, result.err
+}
+
 // Download downloads a local resource from a remote URL.
 // Download will use local TUF metadata, so it's important to call Update before dowloading a new file.
+// Bytes are written to destination as they are downloaded, before the target has been verified,
+// so if Download returns an error destination may hold partial or altered content. Use Open
+// to read a target only after it has been verified.
 func (c *Client) Download(targetName string, destination io.Writer) error {
 	resultC := make(chan error)
 	c.jobs <- func(rm *repoMan) {
@@ -225,19 +363,126 @@ func (c *Client) Download(targetName string, destination io.Writer) error {
 	return <-resultC
 }
 
+// Verify checks that the contents of rdr match the trusted metadata for
+// targetName, using the same hash and length checks as Download. If Update
+// has not been called the metadata in the local repository is used.
+func (c *Client) Verify(targetName string, rdr io.Reader) error {
+	type resultFIM struct {
+		fim FileIntegrityMeta
+		err error
+	}
+	resultC := make(chan resultFIM)
+	c.jobs <- func(rm *repoMan) {
+		fim, err := rm.trustedTarget(targetName)
+		resultC <- resultFIM{fim, err}
+	}
+	result := <-resultC
+	if result.err != nil {
+		return result.err
+	}
+	return verifyTarget(targetName, result.fim, rdr)
+}
+
+// VerifyFile checks that the file at path matches the trusted metadata for
+// targetName. It can be used to check that an installed target has not been
+// altered.
+func (c *Client) VerifyFile(targetName, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "opening file to verify")
+	}
+	defer f.Close()
+	return c.Verify(targetName, f)
+}
+
+// VerifyLocalFile is VerifyFile using only the metadata in the local TUF
+// repository at localRepoPath, so that Notary doesn't need to be reachable.
+func VerifyLocalFile(localRepoPath, targetName, path string) error {
+	repo, err := newLocalRepo(localRepoPath)
+	if err != nil {
+		return err
+	}
+	rm := newRepoMan(repo, nil, nil, &Settings{LocalRepoPath: localRepoPath}, defaultBackupAge, &clock.DefaultClock{})
+	fim, err := rm.trustedTarget(targetName)
+	if err != nil {
+		return err
+	}
+	return verifyFile(targetName, fim, path)
+}
+
+// verifyFile checks that the file at path is the target described by fim.
+func verifyFile(targetName string, fim FileIntegrityMeta, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "opening file to verify")
+	}
+	defer f.Close()
+	return verifyTarget(targetName, fim, f)
+}
+
+func verifyTarget(targetName string, fim FileIntegrityMeta, rdr io.Reader) error {
+	// Read at most one byte more than expected so that a file which is too
+	// long fails without being read in its entirety.
+	if err := fim.verify(io.LimitReader(rdr, fim.Length+1)); err != nil {
+		return errors.Wrapf(err, "verifying %q", targetName)
+	}
+	return nil
+}
+
+// Rollback restores the version of the autoupdate target that was in the
+// staging path before the most recent update. The NotificationHandler is not
+// called, the hosting application is responsible for using the restored file.
+// With WithArchiveExtraction the extracted directory is restored as well. The
+// version that was rolled back is not installed again.
+func (c *Client) Rollback() error {
+	if c.watchedTarget == "" {
+		return errors.New("rollback requires autoupdate")
+	}
+	resultC := make(chan error)
+	c.jobs <- func(rm *repoMan) {
+		if err := c.installer.Rollback(c.watchedTarget); err != nil {
+			resultC <- err
+			return
+		}
+		c.autoupdate.rolledBack()
+		if c.extractArchive {
+			resultC <- c.installer.rollbackExtracted(c.watchedTarget)
+			return
+		}
+		resultC <- nil
+	}
+	return <-resultC
+}
+
 type autoupdater struct {
-	watchedTarget string
-	stagingPath   string
-	notifier      NotificationHandler
-	currentFim    FileIntegrityMeta
+	watchedTarget      string
+	installer          *Installer
+	notifier           NotificationHandler
+	healthCheck        HealthCheck
+	healthCheckTimeout time.Duration
+	currentFim         FileIntegrityMeta
+	state              *autoupdateState
+	window             *DownloadWindow
+	extractArchive     bool
+	archiveManifest    string
+	clock              clock.Clock
+	logger             log.Logger
 }
 
-func newAutoupdater(client *Client, seedFIM FileIntegrityMeta) *autoupdater {
+func newAutoupdater(client *Client, seedFIM FileIntegrityMeta, state *autoupdateState) *autoupdater {
 	return &autoupdater{
-		watchedTarget: client.watchedTarget,
-		stagingPath:   client.stagingPath,
-		notifier:      client.notificationHandler,
-		currentFim:    seedFIM,
+		watchedTarget:      client.watchedTarget,
+		installer:          client.installer,
+		notifier:           client.notificationHandler,
+		healthCheck:        client.healthCheck,
+		healthCheckTimeout: client.healthCheckTimeout,
+		currentFim:         seedFIM,
+		state:              state,
+		window:             client.downloadWindow,
+		extractArchive:     client.extractArchive,
+		archiveManifest:    client.archiveManifest,
+		clock:              client.clock,
+		logger:             client.logger,
 	}
 }
 
@@ -252,13 +497,112 @@ func (au *autoupdater) update(rm *repoMan) {
 		return
 	}
 	if newFim, ok := rm.targets.paths[au.watchedTarget]; ok {
-		if !newFim.Equal(au.currentFim) {
-			if err := downloadAndNotify(rm, au.watchedTarget, au.stagingPath, au.notifier); err != nil {
-				return
+		if newFim.Equal(au.currentFim) {
+			return
+		}
+		if au.state.isRejected(au.watchedTarget, newFim) {
+			level.Debug(au.logger).Log(
+				"msg", "skipping target that failed health check",
+				"target", au.watchedTarget,
+			)
+			return
+		}
+		if au.window != nil && !au.window.Contains(au.clock.Now()) {
+			level.Debug(au.logger).Log(
+				"msg", "outside of download window",
+				"target", au.watchedTarget,
+			)
+			return
+		}
+		dpath, err := au.install(rm, newFim)
+		if err != nil {
+			au.notifier("", err)
+			return
+		}
+		au.currentFim = newFim
+		// Record the delivery before the notifier runs, because the hosting
+		// application may restart itself from the NotificationHandler.
+		au.state.deliver(au.watchedTarget, newFim)
+		if err := au.state.save(); err != nil {
+			level.Info(au.logger).Log(
+				"msg", "saving delivered target",
+				"target", au.watchedTarget,
+				"err", err,
+			)
+		}
+		au.notifier(dpath, nil)
+	}
+}
+
+func (au *autoupdater) install(rm *repoMan, fim FileIntegrityMeta) (string, error) {
+	dpath, err := au.installer.Install(au.watchedTarget, fim, func(destination io.Writer) error {
+		return rm.downloadTargetFrom(au.watchedTarget, au.installer.Path(au.watchedTarget), destination)
+	})
+	if err != nil {
+		return "", err
+	}
+	checkPath := dpath
+	if au.extractArchive {
+		extracted, entryPoint, err := au.installer.extract(au.watchedTarget, au.archiveManifest)
+		if err != nil {
+			if rerr := au.revert(); rerr != nil {
+				return "", errors.Wrapf(rerr, "reverting target that could not be extracted: %s", err)
 			}
-			au.currentFim = newFim
+			return "", errors.Wrap(err, "extracting target")
 		}
+		dpath, checkPath = extracted, extracted
+		if entryPoint != "" {
+			checkPath = entryPoint
+		}
+	}
+	if au.healthCheck == nil {
+		return dpath, nil
+	}
+	checkErr := runHealthCheck(au.healthCheck, au.healthCheckTimeout, checkPath)
+	if checkErr == nil {
+		return dpath, nil
+	}
+	if au.extractArchive {
+		err = au.installer.rollbackExtracted(au.watchedTarget)
+	}
+	if err == nil {
+		err = au.revert()
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "reverting target that failed health check: %s", checkErr)
+	}
+	au.state.reject(au.watchedTarget, fim)
+	if err := au.state.save(); err != nil {
+		level.Info(au.logger).Log(
+			"msg", "saving rejected target",
+			"target", au.watchedTarget,
+			"err", err,
+		)
+	}
+	return "", errors.Wrap(checkErr, "health check failed")
+}
+
+// rolledBack records that the installed target was replaced by the version
+// it was installed over, and rejects the version that was rolled back.
+func (au *autoupdater) rolledBack() {
+	au.currentFim = au.state.rollback(au.watchedTarget)
+	if err := au.state.save(); err != nil {
+		level.Info(au.logger).Log(
+			"msg", "saving rolled back target",
+			"target", au.watchedTarget,
+			"err", err,
+		)
+	}
+}
+
+// revert puts back the version of the target that was there before the last
+// install, or if this was the first install, gets rid of the new one.
+func (au *autoupdater) revert() error {
+	err := au.installer.Rollback(au.watchedTarget)
+	if err == errNoPreviousVersion {
+		err = os.Remove(au.installer.Path(au.watchedTarget))
 	}
+	return err
 }
 
 // workerLoop is the only method that has a reference to the tuf
@@ -293,30 +637,6 @@ func workerLoop(
 	}
 }
 
-func downloadAndNotify(rm *repoMan, watchedTarget, stagingPath string, cb NotificationHandler) error {
-	dpath := filepath.Join(stagingPath, watchedTarget)
-	if err := os.MkdirAll(filepath.Dir(dpath), 0755); err != nil {
-		cb("", err)
-		return err
-	}
-	destination, err := os.Create(dpath)
-	if err != nil {
-		cb("", err)
-		return err
-	}
-	if err := rm.downloadTarget(watchedTarget, destination); err != nil {
-		destination.Close()
-		os.Remove(dpath)
-		cb("", err)
-		return err
-	}
-	// the file descriptor must be closed in order to allow the
-	// notificationHandler to work with the file in the staging path.
-	destination.Close()
-	cb(dpath, nil)
-	return nil
-}
-
 // Stop must be called when done with the updater.
 func (c *Client) Stop() {
 	// cause all goroutines that have the quit channel to exit
@@ -327,9 +647,15 @@ func (c *Client) Stop() {
 
 func defaultHttpClient() *http.Client {
 	return &http.Client{
+		// There is no overall timeout because targets can be large, downloads
+		// are bounded by deadlines and a minimum throughput instead.
 		Transport: &http.Transport{
-			TLSHandshakeTimeout: 5 * time.Second,
+			DialContext: (&net.Dialer{
+				Timeout:   5 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: 10 * time.Second,
 		},
-		Timeout: 5 * time.Second,
 	}
 }
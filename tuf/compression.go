@@ -0,0 +1,175 @@
+package tuf
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// A target can be served compressed by describing the compressed variant in
+// the target's custom metadata. The hashes and length of the target itself
+// are always those of the decompressed file, the hashes and length of the
+// compressed file are optional, but if present both are verified.
+//
+//	"custom": {
+//	  "compression": {
+//	    "format": "gzip",
+//	    "path": "edge/target.gz",
+//	    "hashes": {"sha256": "..."},
+//	    "length": 4096
+//	  }
+//	}
+//
+// If path is omitted the compressed file is expected at the target name
+// followed by the extension for the format, i.e. .gz for gzip and .zst for
+// zstd. If the compressed file isn't on the mirror, or the format isn't
+// supported, the uncompressed target is downloaded instead.
+//
+// Only gzip is built in, because the standard library has no zstd decoder
+// and this package doesn't depend on one. Other formats, including zstd, are
+// enabled with WithDecompressor.
+
+const (
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+type compressionInfo struct {
+	Format string                   `json:"format"`
+	Path   string                   `json:"path,omitempty"`
+	Hashes map[hashingMethod]string `json:"hashes,omitempty"`
+	Length int64                    `json:"length,omitempty"`
+}
+
+var compressionExtensions = map[string]string{
+	compressionGzip: ".gz",
+	compressionZstd: ".zst",
+}
+
+func (ci *compressionInfo) path(target string) string {
+	if ci.Path != "" {
+		return ci.Path
+	}
+	ext, ok := compressionExtensions[ci.Format]
+	if !ok {
+		ext = "." + ci.Format
+	}
+	return target + ext
+}
+
+// Decompressor returns a reader which decompresses rdr.
+type Decompressor func(rdr io.Reader) (io.ReadCloser, error)
+
+// WithDecompressor adds support for downloading targets compressed in
+// format, the value of "format" in the compression metadata of a target.
+// Only gzip is supported by default. For example zstd can be added with
+// github.com/klauspost/compress/zstd:
+//
+//	tuf.WithDecompressor("zstd", func(rdr io.Reader) (io.ReadCloser, error) {
+//		dec, err := zstd.NewReader(rdr)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return dec.IOReadCloser(), nil
+//	})
+//
+// The decompressed target is always limited to its length in the targets
+// metadata and verified, so a Decompressor doesn't need to guard against
+// decompression bombs.
+func WithDecompressor(format string, decompressor Decompressor) Option {
+	return func(c *Client) {
+		c.decompressors[format] = decompressor
+	}
+}
+
+func defaultDecompressors() map[string]Decompressor {
+	return map[string]Decompressor{
+		compressionGzip: func(rdr io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(rdr)
+		},
+	}
+}
+
+func compressionFor(fim FileIntegrityMeta) *compressionInfo {
+	custom := customFor(fim)
+	if custom == nil {
+		return nil
+	}
+	return custom.Compression
+}
+
+// maxCompressedSize limits the size of a compressed target when the size is
+// not in the metadata. Compressing data that doesn't compress well makes it
+// slightly larger.
+func maxCompressedSize(length int64) int64 {
+	return length + length/100 + 64*1024
+}
+
+// openCompressed opens the compressed variant of a target, if there is one
+// that can be used.
+func (rs *repoMan) openCompressed(target string, fim FileIntegrityMeta) (io.ReadCloser, *compressionInfo, Decompressor) {
+	info := compressionFor(fim)
+	if info == nil {
+		return nil, nil, nil
+	}
+	decompress, ok := rs.decompressors[info.Format]
+	if !ok {
+		return nil, nil, nil
+	}
+	body, err := rs.openTarget(info.path(target))
+	if err != nil {
+		return nil, nil, nil
+	}
+	return body, info, decompress
+}
+
+// fetchCompressed decompresses body and verifies it against fim. At most one
+// byte more than the expected length is decompressed, so that decompression
+// bombs are detected without decompressing them.
+func (rs *repoMan) fetchCompressed(target string, fim FileIntegrityMeta, info *compressionInfo, decompress Decompressor, body io.Reader, destination io.Writer) error {
+	limit := info.Length
+	if limit == 0 {
+		limit = maxCompressedSize(fim.Length)
+	}
+	var compressed io.Reader = io.LimitReader(body, limit)
+	if rs.bandwidthLimit > 0 {
+		compressed = newRateLimitedReader(compressed, rs.bandwidthLimit, rs.clock)
+	}
+	var compressedVerifier *fimVerifier
+	if len(info.Hashes) > 0 {
+		var err error
+		compressedVerifier, err = FileIntegrityMeta{Hashes: info.Hashes, Length: info.Length}.newVerifier()
+		if err != nil {
+			return errors.Wrap(err, "verifying compressed target")
+		}
+		// The compressed length is optional, the decompressed target is
+		// always checked against its own length.
+		compressedVerifier.lengthOptional = true
+		compressed = io.TeeReader(compressed, compressedVerifier)
+	}
+	decompressed, err := decompress(compressed)
+	if err != nil {
+		return errors.Wrap(err, "decompressing target")
+	}
+	defer decompressed.Close()
+
+	var stream io.Reader = io.LimitReader(decompressed, fim.Length+1)
+	if rs.progress != nil {
+		stream = newProgressReader(stream, target, fim.Length, rs.progress, rs.clock)
+	}
+	if err := fim.verify(io.TeeReader(stream, destination)); err != nil {
+		return errors.Wrap(err, "verifying current target download")
+	}
+	if compressedVerifier != nil {
+		// The decompressor may not have read trailing bytes.
+		if _, err := io.Copy(ioutil.Discard, compressed); err != nil {
+			return errors.Wrap(err, "reading compressed target")
+		}
+		if err := compressedVerifier.check(); err != nil {
+			return errors.Wrap(err, "verifying compressed target")
+		}
+	}
+	return nil
+}
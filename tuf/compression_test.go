@@ -0,0 +1,130 @@
+package tuf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	cjson "github.com/docker/go/canonical/json"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(t *testing.T, content []byte) []byte {
+	var buff bytes.Buffer
+	gz := gzip.NewWriter(&buff)
+	_, err := gz.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buff.Bytes()
+}
+
+func compressedFIM(t *testing.T, content []byte, info compressionInfo) FileIntegrityMeta {
+	fim := testFIM(content)
+	buff, err := cjson.MarshalCanonical(targetCustom{Compression: &info})
+	require.NoError(t, err)
+	custom := cjson.RawMessage(buff)
+	fim.Custom = &custom
+	return fim
+}
+
+func TestCompressedDownload(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	content := bytes.Repeat([]byte("compress me "), 1000)
+	compressed := gzipped(t, content)
+	compressedFim := testFIM(compressed)
+
+	download := func(fim FileIntegrityMeta, files map[string][]byte) ([]byte, []string, error) {
+		m := &mapMirror{targets: files}
+		rs := newRepoMan(nil, nil, m, &Settings{}, defaultBackupAge, clock.NewMockClock(testTime))
+		rs.decompressors["identity"] = func(rdr io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(rdr), nil
+		}
+		rs.targets = &RootTarget{paths: FimMap{"target": fim}}
+		var buff bytes.Buffer
+		err := rs.downloadTarget("target", &buff)
+		return buff.Bytes(), m.requested, err
+	}
+
+	// only the compressed file is downloaded, both representations are verified
+	fim := compressedFIM(t, content, compressionInfo{Format: compressionGzip, Hashes: compressedFim.Hashes, Length: compressedFim.Length})
+	output, requested, err := download(fim, map[string][]byte{"target.gz": compressed, "target": content})
+	require.NoError(t, err)
+	assert.Equal(t, content, output)
+	assert.Equal(t, []string{"target.gz"}, requested)
+
+	// the compressed file can be somewhere else, and doesn't have to be signed
+	fim = compressedFIM(t, content, compressionInfo{Format: compressionGzip, Path: "compressed/target"})
+	output, requested, err = download(fim, map[string][]byte{"compressed/target": compressed})
+	require.NoError(t, err)
+	assert.Equal(t, content, output)
+	assert.Equal(t, []string{"compressed/target"}, requested)
+
+	// formats can be added
+	fim = compressedFIM(t, content, compressionInfo{Format: "identity"})
+	output, requested, err = download(fim, map[string][]byte{"target.identity": content})
+	require.NoError(t, err)
+	assert.Equal(t, content, output)
+
+	// zstd isn't built in, so its file isn't requested
+	fim = compressedFIM(t, content, compressionInfo{Format: compressionZstd})
+	output, requested, err = download(fim, map[string][]byte{"target.zst": content, "target": content})
+	require.NoError(t, err)
+	assert.Equal(t, content, output)
+	assert.Equal(t, []string{"target"}, requested)
+
+	// without a compressed file, or a decompressor, the target is downloaded
+	for _, format := range []string{compressionGzip, compressionZstd} {
+		fim = compressedFIM(t, content, compressionInfo{Format: format})
+		output, requested, err = download(fim, map[string][]byte{"target": content})
+		require.NoError(t, err)
+		assert.Equal(t, content, output)
+		assert.Equal(t, "target", requested[len(requested)-1])
+	}
+
+	// a compressed file that doesn't match its signed hash is rejected
+	fim = compressedFIM(t, content, compressionInfo{Format: compressionGzip, Hashes: compressedFim.Hashes, Length: compressedFim.Length})
+	other := gzipped(t, append([]byte(nil), content...))
+	other[len(other)-10] ^= 0xff
+	_, _, err = download(fim, map[string][]byte{"target.gz": other})
+	require.Error(t, err)
+}
+
+func TestDecompressionBomb(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	expected := []byte("small")
+	bomb := gzipped(t, make([]byte, 10*1024*1024))
+	m := &mapMirror{targets: map[string][]byte{"target.gz": bomb}}
+	rs := newRepoMan(nil, nil, m, &Settings{}, defaultBackupAge, clock.NewMockClock(testTime))
+	rs.targets = &RootTarget{paths: FimMap{"target": compressedFIM(t, expected, compressionInfo{Format: compressionGzip})}}
+
+	var written int64
+	err := rs.downloadTarget("target", writerFunc(func(p []byte) (int, error) {
+		written += int64(len(p))
+		return len(p), nil
+	}))
+	require.Error(t, err)
+	assert.Equal(t, errLengthIncorrect, errors.Cause(err))
+	assert.True(t, written <= int64(len(expected))+1, written)
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestWithDecompressor(t *testing.T) {
+	identity := func(rdr io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(rdr), nil
+	}
+	client := newClient(WithDecompressor(compressionZstd, identity))
+	assert.Contains(t, client.decompressors, compressionGzip)
+	assert.Contains(t, client.decompressors, compressionZstd)
+	assert.Equal(t, "target.zst", (&compressionInfo{Format: compressionZstd}).path("target"))
+}
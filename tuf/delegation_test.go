@@ -131,10 +131,10 @@ func TestTargetReadWithValidations(t *testing.T) {
 	rootRole, snapshotRole, rootTarget := setupValidationTest(t, testRootPath)
 	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
 
+	notary, err := newNotaryRepo(&Settings{NotaryURL: svr.URL, GUN: testRootPath}, defaultSizeLimits, testHTTPClient())
+	require.NoError(t, err)
 	rrs := notaryTargetFetcherSettings{
-		gun:             testRootPath,
-		client:          testHTTPClient(),
-		url:             svr.URL,
+		remote:          notary,
 		maxResponseSize: defaultMaxResponseSize,
 		rootRole:        rootRole,
 		snapshotRole:    snapshotRole,
@@ -144,7 +144,6 @@ func TestTargetReadWithValidations(t *testing.T) {
 	rtr, err := newNotaryTargetFetcher(&rrs)
 	require.NoError(t, err)
 	require.NotNil(t, rtr)
-	var notary notaryRepo
 	remoteRootTarget, err := notary.targets(rtr)
 	require.NoError(t, err)
 	require.NotNil(t, remoteRootTarget)
@@ -304,6 +303,47 @@ func interleavedOperations(t *testing.T, settings *Settings, c *http.Client, sta
 	}
 }
 
+func verifyInstalledFile(t *testing.T, settings *Settings, c *http.Client, stageDir string, k *clock.MockClock) {
+	client, err := NewClient(settings, WithHTTPClient(c), withClock(k))
+	require.NoError(t, err)
+	defer client.Stop()
+	_, _, err = client.Update()
+	require.NoError(t, err)
+	download := filepath.Join(stageDir, "target")
+	out, err := os.Create(download)
+	require.NoError(t, err)
+	defer out.Close()
+	require.NoError(t, client.Download("edge/target", out))
+	out.Close()
+
+	assert.NoError(t, client.VerifyFile("edge/target", download))
+	assert.Error(t, client.VerifyFile("no/such/target", download))
+	assert.Error(t, client.VerifyFile("edge/target", filepath.Join(stageDir, "missing")))
+	// the local repository is enough, Notary doesn't need to be reachable
+	assert.NoError(t, VerifyLocalFile(settings.LocalRepoPath, "edge/target", download))
+	assert.Error(t, VerifyLocalFile(settings.LocalRepoPath, "no/such/target", download))
+
+	buff, err := ioutil.ReadFile(download)
+	require.NoError(t, err)
+	err = client.Verify("edge/target", bytes.NewReader(append(buff, 'x')))
+	assert.Equal(t, errLengthIncorrect, errors.Cause(err))
+	buff[0]++
+	err = client.Verify("edge/target", bytes.NewReader(buff))
+	assert.Equal(t, errHashIncorrect, errors.Cause(err))
+}
+
+// Before Update is called the trusted metadata comes from the local repository.
+func verifyBeforeUpdate(t *testing.T, settings *Settings, c *http.Client, stageDir string, k *clock.MockClock) {
+	client, err := NewClient(settings, WithHTTPClient(c), withClock(k))
+	require.NoError(t, err)
+	defer client.Stop()
+	buff := testAsset(t, path.Join(mirrorRoot, "2", "edge", "target"))
+	assert.Error(t, client.Verify("edge/target", bytes.NewReader(buff)))
+	_, _, err = client.Update()
+	require.NoError(t, err)
+	assert.NoError(t, client.Verify("edge/target", bytes.NewReader(buff)))
+}
+
 func wontCrashOnNilAutoupdate(t *testing.T, settings *Settings, c *http.Client, stageDir string, k *clock.MockClock) {
 	_, err := NewClient(
 		settings, WithHTTPClient(c),
@@ -442,6 +482,8 @@ func TestEndToEnd(t *testing.T) {
 		{"nil autoupdate func", 1, 2, wontCrashOnNilAutoupdate},
 		{"autoupdate interval works", 1, 2, autoupdateDetectedChangeAfterInterval},
 		{"interleaved operations", 1, 2, interleavedOperations},
+		{"verify installed file", 1, 2, verifyInstalledFile},
+		{"verify before update", 1, 2, verifyBeforeUpdate},
 		{"truncated download", 1, 2, genCorruptDownloadTest(replaceBodyCorruption, errLengthIncorrect)},
 		{"corrupt download", 1, 2, genCorruptDownloadTest(overwriteCorruption, errHashIncorrect)},
 		{"empty download", 1, 2, genCorruptDownloadTest(emptyBodyCorruption, errLengthIncorrect)},
@@ -0,0 +1,221 @@
+package tuf
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	cjson "github.com/docker/go/canonical/json"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// A delta patch is published as an additional target whose custom metadata
+// describes the target it produces and the version it applies to:
+//
+//	"custom": {
+//	  "delta": {
+//	    "format": "bsdiff40",
+//	    "target": "edge/target",
+//	    "from": {"hashes": {"sha256": "..."}, "length": 1000},
+//	    "to": {"hashes": {"sha256": "..."}, "length": 980}
+//	  }
+//	}
+//
+// The patch itself is verified like any other target before it is applied,
+// and the output is verified against the metadata of the full target, so a
+// patch is never trusted more than a full download.
+
+const deltaFormatBsdiff = "bsdiff40"
+
+type deltaInfo struct {
+	Format string            `json:"format"`
+	Target string            `json:"target"`
+	From   FileIntegrityMeta `json:"from"`
+	To     FileIntegrityMeta `json:"to"`
+}
+
+// targetCustom is the custom metadata of a target used by this package.
+type targetCustom struct {
+	Delta       *deltaInfo       `json:"delta,omitempty"`
+	Compression *compressionInfo `json:"compression,omitempty"`
+}
+
+var (
+	errNoDelta      = errors.New("no delta patch for installed version")
+	errInvalidPatch = errors.New("invalid bsdiff patch")
+)
+
+// downloadTargetFrom downloads target to destination, using a delta patch
+// against the file at basePath if one is available. If the patch can't be
+// used for any reason the full target is downloaded.
+func (rs *repoMan) downloadTargetFrom(target, basePath string, destination io.Writer) error {
+	err := rs.downloadDelta(target, basePath, destination)
+	if err == nil {
+		return nil
+	}
+	logger := level.Info(rs.logger)
+	if err == errNoDelta {
+		logger = level.Debug(rs.logger)
+	}
+	logger.Log(
+		"msg", "delta update failed, downloading full target",
+		"target", target,
+		"err", err,
+	)
+	return rs.downloadTarget(target, destination)
+}
+
+// downloadDelta reconstructs target from the file at basePath and a delta
+// patch. Nothing is written to destination unless the reconstructed target
+// has been verified.
+func (rs *repoMan) downloadDelta(target, basePath string, destination io.Writer) error {
+	if rs.targets == nil {
+		return errors.New("no targets present, was Update called?")
+	}
+	fim, ok := rs.targets.paths[target]
+	if !ok {
+		return errors.Errorf("unknown target %q", target)
+	}
+	patchName, err := rs.findDelta(target, fim, basePath)
+	if err != nil {
+		return err
+	}
+	var patch bytes.Buffer
+	if err := rs.downloadTarget(patchName, &patch); err != nil {
+		return errors.Wrap(err, "downloading delta patch")
+	}
+	base, err := ioutil.ReadFile(basePath)
+	if err != nil {
+		return errors.Wrap(err, "reading delta base")
+	}
+	output, err := applyBsdiff(base, patch.Bytes(), fim.Length)
+	if err != nil {
+		return errors.Wrap(err, "applying delta patch")
+	}
+	if err := fim.verify(bytes.NewReader(output)); err != nil {
+		return errors.Wrap(err, "verifying patched target")
+	}
+	if _, err := destination.Write(output); err != nil {
+		return errors.Wrap(err, "writing patched target")
+	}
+	return nil
+}
+
+// findDelta returns the name of a patch which produces target from the file
+// at basePath.
+func (rs *repoMan) findDelta(target string, fim FileIntegrityMeta, basePath string) (string, error) {
+	var names []string
+	for name := range rs.targets.paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	err := errNoDelta
+	for _, name := range names {
+		delta := deltaFor(rs.targets.paths[name])
+		if delta == nil || delta.Format != deltaFormatBsdiff || delta.Target != target || !delta.To.Equal(fim) {
+			continue
+		}
+		f, openErr := os.Open(basePath)
+		if openErr != nil {
+			return "", errors.Wrap(openErr, "opening delta base")
+		}
+		verifyErr := delta.From.verify(io.LimitReader(f, delta.From.Length+1))
+		f.Close()
+		if verifyErr == nil {
+			return name, nil
+		}
+		// The base may match another patch, so keep looking.
+		err = errors.Wrapf(verifyErr, "delta base doesn't match %q", name)
+	}
+	return "", err
+}
+
+func deltaFor(fim FileIntegrityMeta) *deltaInfo {
+	custom := customFor(fim)
+	if custom == nil {
+		return nil
+	}
+	return custom.Delta
+}
+
+// customFor returns the custom metadata of a target, or nil if the target
+// has none that is understood.
+func customFor(fim FileIntegrityMeta) *targetCustom {
+	if fim.Custom == nil {
+		return nil
+	}
+	var custom targetCustom
+	if err := cjson.Unmarshal(*fim.Custom, &custom); err != nil {
+		return nil
+	}
+	return &custom
+}
+
+// applyBsdiff applies a patch in the BSDIFF40 format produced by bsdiff to
+// base. maxSize is the size the output is expected to be, larger outputs are
+// rejected before any memory is allocated for them.
+// See http://www.daemonology.net/bsdiff/
+func applyBsdiff(base, patch []byte, maxSize int64) ([]byte, error) {
+	if len(patch) < 32 || string(patch[:8]) != "BSDIFF40" {
+		return nil, errInvalidPatch
+	}
+	ctrlLen := offtin(patch[8:16])
+	diffLen := offtin(patch[16:24])
+	newSize := offtin(patch[24:32])
+	if ctrlLen < 0 || diffLen < 0 || newSize < 0 || newSize > maxSize ||
+		32+ctrlLen+diffLen > int64(len(patch)) {
+		return nil, errInvalidPatch
+	}
+	ctrl := bzip2.NewReader(bytes.NewReader(patch[32 : 32+ctrlLen]))
+	diff := bzip2.NewReader(bytes.NewReader(patch[32+ctrlLen : 32+ctrlLen+diffLen]))
+	extra := bzip2.NewReader(bytes.NewReader(patch[32+ctrlLen+diffLen:]))
+
+	output := make([]byte, newSize)
+	var (
+		newPos, oldPos int64
+		buff           [24]byte
+	)
+	oldSize := int64(len(base))
+	for newPos < newSize {
+		if _, err := io.ReadFull(ctrl, buff[:]); err != nil {
+			return nil, errors.Wrap(err, "reading patch control block")
+		}
+		diffSize, extraSize, seek := offtin(buff[0:8]), offtin(buff[8:16]), offtin(buff[16:24])
+		if diffSize < 0 || extraSize < 0 || newPos+diffSize > newSize {
+			return nil, errInvalidPatch
+		}
+		if _, err := io.ReadFull(diff, output[newPos:newPos+diffSize]); err != nil {
+			return nil, errors.Wrap(err, "reading patch diff block")
+		}
+		for i := int64(0); i < diffSize; i++ {
+			if oldPos+i >= 0 && oldPos+i < oldSize {
+				output[newPos+i] += base[oldPos+i]
+			}
+		}
+		newPos += diffSize
+		oldPos += diffSize
+		if newPos+extraSize > newSize {
+			return nil, errInvalidPatch
+		}
+		if _, err := io.ReadFull(extra, output[newPos:newPos+extraSize]); err != nil {
+			return nil, errors.Wrap(err, "reading patch extra block")
+		}
+		newPos += extraSize
+		oldPos += seek
+	}
+	return output, nil
+}
+
+// offtin decodes the sign and magnitude integers used by bsdiff.
+func offtin(buff []byte) int64 {
+	y := int64(binary.LittleEndian.Uint64(buff) &^ (1 << 63))
+	if buff[7]&0x80 != 0 {
+		return -y
+	}
+	return y
+}
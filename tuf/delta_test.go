@@ -0,0 +1,131 @@
+package tuf
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	cjson "github.com/docker/go/canonical/json"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mapMirror serves targets from memory and records what was requested.
+type mapMirror struct {
+	targets   map[string][]byte
+	requested []string
+}
+
+func (m *mapMirror) open(_ context.Context, target string) (io.ReadCloser, error) {
+	m.requested = append(m.requested, target)
+	content, ok := m.targets[target]
+	if !ok {
+		return nil, errNotFound
+	}
+	return ioutil.NopCloser(bytes.NewReader(content)), nil
+}
+
+func deltaFIM(t *testing.T, patch []byte, delta deltaInfo) FileIntegrityMeta {
+	fim := testFIM(patch)
+	buff, err := cjson.MarshalCanonical(targetCustom{Delta: &delta})
+	require.NoError(t, err)
+	custom := cjson.RawMessage(buff)
+	fim.Custom = &custom
+	return fim
+}
+
+func TestApplyBsdiff(t *testing.T) {
+	base := testAsset(t, "testdata/delta/base")
+	target := testAsset(t, "testdata/delta/target")
+	patch := testAsset(t, "testdata/delta/target.bsdiff")
+
+	output, err := applyBsdiff(base, patch, int64(len(target)))
+	require.NoError(t, err)
+	assert.Equal(t, target, output)
+
+	// the output size is checked before it is allocated
+	_, err = applyBsdiff(base, patch, int64(len(target)-1))
+	assert.Equal(t, errInvalidPatch, err)
+	_, err = applyBsdiff(base, patch[:40], int64(len(target)))
+	assert.Error(t, err)
+	_, err = applyBsdiff(base, []byte("BSDIFF41"), int64(len(target)))
+	assert.Equal(t, errInvalidPatch, err)
+}
+
+func TestDeltaDownload(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	base := testAsset(t, "testdata/delta/base")
+	target := testAsset(t, "testdata/delta/target")
+	patch := testAsset(t, "testdata/delta/target.bsdiff")
+	dir, err := ioutil.TempDir("", "delta")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	basePath := filepath.Join(dir, "installed")
+	require.NoError(t, ioutil.WriteFile(basePath, base, 0644))
+
+	var logs bytes.Buffer
+	newRepo := func(patchContent []byte) (*repoMan, *mapMirror) {
+		logs.Reset()
+		m := &mapMirror{targets: map[string][]byte{
+			"edge/target":        target,
+			"edge/target.bsdiff": patchContent,
+		}}
+		rs := newRepoMan(nil, nil, m, &Settings{}, defaultBackupAge, clock.NewMockClock(testTime))
+		rs.logger = log.NewLogfmtLogger(&logs)
+		rs.targets = &RootTarget{paths: FimMap{
+			"edge/target": testFIM(target),
+			"edge/target.bsdiff": deltaFIM(t, patch, deltaInfo{
+				Format: deltaFormatBsdiff,
+				Target: "edge/target",
+				From:   testFIM(base),
+				To:     testFIM(target),
+			}),
+		}}
+		return rs, m
+	}
+
+	// the patch is used when the installed file matches
+	rs, m := newRepo(patch)
+	var buff bytes.Buffer
+	require.NoError(t, rs.downloadTargetFrom("edge/target", basePath, &buff))
+	assert.Equal(t, target, buff.Bytes())
+	assert.Equal(t, []string{"edge/target.bsdiff"}, m.requested)
+	assert.Empty(t, logs.String())
+
+	// a corrupt patch falls back to the full target
+	corrupt := append([]byte(nil), patch...)
+	corrupt[len(corrupt)-1]++
+	rs, m = newRepo(corrupt)
+	buff.Reset()
+	require.NoError(t, rs.downloadTargetFrom("edge/target", basePath, &buff))
+	assert.Equal(t, target, buff.Bytes())
+	assert.Equal(t, []string{"edge/target.bsdiff", "edge/target"}, m.requested)
+	assert.Contains(t, logs.String(), "downloading delta patch")
+
+	// so does an installed file that doesn't match the base of the patch
+	require.NoError(t, ioutil.WriteFile(basePath, []byte("something else"), 0644))
+	rs, m = newRepo(patch)
+	buff.Reset()
+	require.NoError(t, rs.downloadTargetFrom("edge/target", basePath, &buff))
+	assert.Equal(t, target, buff.Bytes())
+	assert.Equal(t, []string{"edge/target"}, m.requested)
+	assert.Contains(t, logs.String(), "delta base doesn't match")
+}
+
+func TestFIMCustomRoundTrip(t *testing.T) {
+	fim := deltaFIM(t, []byte("patch"), deltaInfo{Format: deltaFormatBsdiff, Target: "edge/target"})
+	clone := fim.clone()
+	require.NotNil(t, clone.Custom)
+	assert.Equal(t, *fim.Custom, *clone.Custom)
+	delta := deltaFor(*clone)
+	require.NotNil(t, delta)
+	assert.Equal(t, "edge/target", delta.Target)
+	assert.Nil(t, deltaFor(testFIM([]byte("full"))))
+}
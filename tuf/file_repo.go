@@ -0,0 +1,210 @@
+package tuf
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const fileURLScheme = "file"
+
+// WithFileURLs allows the NotaryURL and MirrorURL Settings to be file URLs,
+// i.e. file:///var/lib/mirror, which point to local directories laid out the
+// same way as a Notary server and a mirror:
+//
+//	<NotaryURL>/v2/<GUN>/_trust/tuf/<role>.json
+//	<MirrorURL>/<GUN>/<target>
+//
+// Roles and targets read from a directory are verified the same way as roles
+// and targets downloaded over https. File URLs are rejected unless this option
+// is used, so that they can't be enabled by accident in production.
+func WithFileURLs() Option {
+	return func(c *Client) {
+		c.allowFileURLs = true
+	}
+}
+
+func isFileURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && u.Scheme == fileURLScheme
+}
+
+var windowsDrivePath = regexp.MustCompile(`^/[a-zA-Z]:/`)
+
+// fileURLPath returns the local directory a file URL refers to. The directory
+// must exist.
+func fileURLPath(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.Wrap(err, "parsing file url")
+	}
+	if u.Scheme != fileURLScheme {
+		return "", errors.Errorf("url scheme must be %q", fileURLScheme)
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return "", errors.Errorf("file url host must be empty, got %q", u.Host)
+	}
+	p := u.Path
+	// file:///C:/mirror has the path /C:/mirror
+	if windowsDrivePath.MatchString(p) {
+		p = p[1:]
+	}
+	dir := filepath.FromSlash(p)
+	if err := validatePath(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// staticRepo implements the parts of remoteRepo that are the same for every
+// source of roles that isn't Notary.
+type staticRepo struct {
+	// fetch returns the body of a role, or errNotFound.
+	fetch      func(roleName string) (io.ReadCloser, error)
+	sizeLimits SizeLimits
+}
+
+func (s *staticRepo) root(opts ...repoOption) (*Root, error) {
+	var optVal repoOptions
+	for _, opt := range opts {
+		opt(&optVal)
+	}
+	roleVal := roleRoot
+	if optVal.rootOptions.version > 0 {
+		roleVal = role(fmt.Sprintf("%d.%s", optVal.rootOptions.version, roleRoot))
+	}
+	var root Root
+	if err := s.getRole(roleVal, &root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+func (s *staticRepo) timestamp() (*Timestamp, error) {
+	var timestamp Timestamp
+	if err := s.getRole(roleTimestamp, &timestamp); err != nil {
+		return nil, err
+	}
+	return &timestamp, nil
+}
+
+func (s *staticRepo) snapshot(opts ...repoOption) (*Snapshot, error) {
+	var snapshot Snapshot
+	if err := s.getRole(roleSnapshot, &snapshot, opts...); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (s *staticRepo) targets(fetcher roleFetcher) (*RootTarget, error) {
+	rootTarget, err := targetTreeBuilder(fetcher)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting target role")
+	}
+	return rootTarget, nil
+}
+
+func (s *staticRepo) getRole(roleName role, val interface{}, opts ...repoOption) error {
+	if err := validateRole(roleName); err != nil {
+		return errors.Wrap(err, "getting role")
+	}
+	body, err := s.fetch(string(roleName))
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return decodeRole(body, s.sizeLimits.forRole(string(roleName)), val, opts...)
+}
+
+// fileRepo is a remote repository backed by a local directory with the same
+// layout as a Notary server.
+type fileRepo struct {
+	staticRepo
+	dir string
+	gun string
+}
+
+func newFileRepo(settings *Settings, sizeLimits SizeLimits) (*fileRepo, error) {
+	dir, err := fileURLPath(settings.NotaryURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "remote repo url validation")
+	}
+	r := &fileRepo{dir: dir, gun: settings.GUN}
+	r.staticRepo = staticRepo{fetch: r.openRole, sizeLimits: sizeLimits}
+	return r, nil
+}
+
+// Returns nil if the repository has a directory for our GUN.
+func (r *fileRepo) ping() error {
+	fi, err := os.Stat(r.roleDir())
+	if err != nil {
+		return errors.Wrap(err, "ping")
+	}
+	if !fi.IsDir() {
+		return errors.Errorf("%q is not a directory", r.roleDir())
+	}
+	return nil
+}
+
+func (r *fileRepo) roleDir() string {
+	return filepath.Join(r.dir, "v2", filepath.FromSlash(r.gun), "_trust", "tuf")
+}
+
+func (r *fileRepo) openRole(roleName string) (io.ReadCloser, error) {
+	name, err := localFileName(roleName + ".json")
+	if err != nil {
+		return nil, err
+	}
+	return openLocalFile(filepath.Join(r.roleDir(), name))
+}
+
+// fileMirror is a mirror backed by a local directory.
+type fileMirror struct {
+	dir string
+	gun string
+}
+
+func newFileMirror(settings *Settings) (*fileMirror, error) {
+	dir, err := fileURLPath(settings.MirrorURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "mirror url validation")
+	}
+	return &fileMirror{dir: dir, gun: settings.GUN}, nil
+}
+
+func (m *fileMirror) open(_ context.Context, target string) (io.ReadCloser, error) {
+	name, err := localFileName(target)
+	if err != nil {
+		return nil, err
+	}
+	return openLocalFile(filepath.Join(m.dir, filepath.FromSlash(m.gun), name))
+}
+
+// localFileName converts a slash separated name to a relative file path,
+// refusing names that would escape the directory they are joined to.
+func localFileName(name string) (string, error) {
+	cleaned := path.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") || path.IsAbs(cleaned) {
+		return "", errors.Errorf("invalid path %q", name)
+	}
+	return filepath.FromSlash(cleaned), nil
+}
+
+func openLocalFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "opening file")
+	}
+	return f, nil
+}
@@ -0,0 +1,94 @@
+package tuf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupFileRepo lays out the version 2 test repository and mirror in
+// directories the way they would be served by Notary and a mirror.
+func setupFileRepo(t *testing.T, dir string) (notaryDir, mirrorDir string) {
+	notaryDir = filepath.Join(dir, "notary")
+	roleDir := filepath.Join(notaryDir, "v2", filepath.FromSlash(testGUN), "_trust", "tuf")
+	require.NoError(t, os.MkdirAll(roleDir, 0755))
+	createLocalTestRepo(t, roleDir, path.Join(assetRoot, "2"))
+
+	mirrorDir = filepath.Join(dir, "mirror")
+	targetPath := filepath.Join(mirrorDir, filepath.FromSlash(testGUN), "edge", "target")
+	require.NoError(t, os.MkdirAll(filepath.Dir(targetPath), 0755))
+	buff := testAsset(t, path.Join(mirrorRoot, "2", "edge", "target"))
+	require.NoError(t, ioutil.WriteFile(targetPath, buff, 0644))
+	return notaryDir, mirrorDir
+}
+
+func fileURL(dir string) string {
+	p := filepath.ToSlash(dir)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return "file://" + p
+}
+
+func TestFileURLs(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	k := clock.NewMockClock(testTime)
+	dir, err := ioutil.TempDir("", "filerepo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	notaryDir, mirrorDir := setupFileRepo(t, dir)
+
+	settings := offlineSettings(t, 1)
+	defer os.RemoveAll(settings.LocalRepoPath)
+	settings.NotaryURL = fileURL(notaryDir)
+	settings.MirrorURL = fileURL(mirrorDir)
+
+	// file URLs must be explicitly allowed
+	_, err = NewClient(settings, withClock(k))
+	require.Error(t, err)
+
+	client, err := NewClient(settings, withClock(k), WithFileURLs())
+	require.NoError(t, err)
+	defer client.Stop()
+	_, latest, err := client.Update()
+	require.NoError(t, err)
+	assert.False(t, latest)
+	var buff bytes.Buffer
+	require.NoError(t, client.Download("edge/target", &buff))
+	assert.Equal(t, testAsset(t, path.Join(mirrorRoot, "2", "edge", "target")), buff.Bytes())
+	assert.Equal(t, errNotFound, errors.Cause(client.Download("latest/target", ioutil.Discard)))
+}
+
+func TestFileURLValidation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filerepo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p, err := fileURLPath(fileURL(dir))
+	require.NoError(t, err)
+	assert.Equal(t, dir, p)
+
+	for _, u := range []string{
+		"https://mirror.example.com",
+		"file://mirror.example.com/dir",
+		fileURL(filepath.Join(dir, "missing")),
+	} {
+		_, err := fileURLPath(u)
+		assert.Error(t, err, u)
+	}
+
+	for _, name := range []string{"../escape", "/abs", ".."} {
+		_, err := localFileName(name)
+		assert.Error(t, err, name)
+	}
+}
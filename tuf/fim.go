@@ -5,8 +5,8 @@ import (
 	"encoding/base64"
 	"hash"
 	"io"
-	"io/ioutil"
 
+	cjson "github.com/docker/go/canonical/json"
 	"github.com/pkg/errors"
 )
 
@@ -15,6 +15,12 @@ import (
 type FileIntegrityMeta struct {
 	Hashes map[hashingMethod]string `json:"hashes"`
 	Length int64                    `json:"length"`
+	// Version is the version of a role listed in snapshot or timestamp
+	// metadata. Notary doesn't list versions, in which case it is zero.
+	Version int `json:"version,omitempty"`
+	// Custom is application specific information about a target. It is
+	// signed along with the hashes and length.
+	Custom *cjson.RawMessage `json:"custom,omitempty"`
 }
 
 func newFileIntegrityMeta() *FileIntegrityMeta {
@@ -28,12 +34,17 @@ func (fim FileIntegrityMeta) clone() *FileIntegrityMeta {
 	for k, v := range fim.Hashes {
 		h[k] = v
 	}
-	return &FileIntegrityMeta{h, fim.Length}
+	var custom *cjson.RawMessage
+	if fim.Custom != nil {
+		c := append(cjson.RawMessage(nil), *fim.Custom...)
+		custom = &c
+	}
+	return &FileIntegrityMeta{Hashes: h, Length: fim.Length, Version: fim.Version, Custom: custom}
 }
 
 // Equal is deep comparison of two FileIntegrityMeta
 func (fim FileIntegrityMeta) Equal(fimTarget FileIntegrityMeta) bool {
-	if fim.Length != fimTarget.Length {
+	if fim.Length != fimTarget.Length || fim.Version != fimTarget.Version {
 		return false
 	}
 	if len(fim.Hashes) != len(fimTarget.Hashes) {
@@ -53,28 +64,76 @@ func (fim FileIntegrityMeta) Equal(fimTarget FileIntegrityMeta) bool {
 
 // File hash and length validation per TUF 5.5.2
 func (fim FileIntegrityMeta) verify(rdr io.Reader) error {
-	var hashes []hashInfo
+	v, err := fim.newVerifier()
+	if err != nil {
+		return err
+	}
+	return v.verify(rdr)
+}
+
+// verifyRole validates role metadata listed in snapshot or timestamp metadata,
+// which may omit the length of a role. In that case only its hashes are
+// checked.
+func (fim FileIntegrityMeta) verifyRole(rdr io.Reader) error {
+	v, err := fim.newVerifier()
+	if err != nil {
+		return err
+	}
+	v.lengthOptional = true
+	return v.verify(rdr)
+}
+
+// fimVerifier hashes bytes written to it, so that a stream can be verified
+// while it is being read by something else.
+type fimVerifier struct {
+	fim    FileIntegrityMeta
+	hashes []hashInfo
+	length int64
+	// lengthOptional skips the length check if the length is omitted and
+	// there are hashes to check instead.
+	lengthOptional bool
+}
+
+func (fim FileIntegrityMeta) newVerifier() (*fimVerifier, error) {
+	v := &fimVerifier{fim: fim}
 	for algo, expectedHash := range fim.Hashes {
 		var hashFunc hash.Hash
 		valid, err := base64.StdEncoding.DecodeString(expectedHash)
 		if err != nil {
-			return errors.New("invalid hash in verify")
+			return nil, errors.New("invalid hash in verify")
 		}
 		hashFunc, err = getHasher(algo)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		rdr = io.TeeReader(rdr, hashFunc)
-		hashes = append(hashes, hashInfo{hashFunc, valid})
+		v.hashes = append(v.hashes, hashInfo{hashFunc, valid})
 	}
-	length, err := io.Copy(ioutil.Discard, rdr)
-	if err != nil {
+	return v, nil
+}
+
+func (v *fimVerifier) Write(p []byte) (int, error) {
+	for _, h := range v.hashes {
+		h.h.Write(p)
+	}
+	v.length += int64(len(p))
+	return len(p), nil
+}
+
+func (v *fimVerifier) verify(rdr io.Reader) error {
+	if _, err := io.Copy(v, rdr); err != nil {
 		return err
 	}
-	if length != fim.Length {
+	return v.check()
+}
+
+// check returns an error unless the bytes written match the length and
+// hashes in the file integrity information.
+func (v *fimVerifier) check() error {
+	omitted := v.lengthOptional && v.fim.Length == 0 && len(v.hashes) > 0
+	if !omitted && v.length != v.fim.Length {
 		return errLengthIncorrect
 	}
-	for _, h := range hashes {
+	for _, h := range v.hashes {
 		if subtle.ConstantTimeCompare(h.valid, h.h.Sum(nil)) != 1 {
 			return errHashIncorrect
 		}
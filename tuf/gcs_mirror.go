@@ -0,0 +1,89 @@
+package tuf
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const defaultGCSEndpoint = "https://storage.googleapis.com"
+
+// GCSMirrorConfig describes a Google Cloud Storage bucket containing targets
+// at <Prefix>/<GUN>/<target>.
+type GCSMirrorConfig struct {
+	// Endpoint defaults to https://storage.googleapis.com
+	Endpoint string
+	Bucket   string
+	// Prefix is prepended to object names, it may be empty.
+	Prefix string
+	// Token is called before each download to get an OAuth2 access token
+	// which is sent as a bearer token. If nil, requests are anonymous.
+	Token func() (string, error)
+	// SignURL, if not nil, returns a signed https URL for an object which is
+	// used instead of a bearer token.
+	SignURL func(bucket, object string) (string, error)
+}
+
+// WithGCSMirror downloads targets from a Google Cloud Storage bucket instead
+// of from MirrorURL. Requests are made with the Client's http.Client.
+func WithGCSMirror(config GCSMirrorConfig) Option {
+	return func(c *Client) {
+		c.newMirrorTransport = func(c *Client) (MirrorTransport, error) {
+			return newGCSMirror(config, c.client)
+		}
+	}
+}
+
+type gcsMirror struct {
+	config   GCSMirrorConfig
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func newGCSMirror(config GCSMirrorConfig, client *http.Client) (*gcsMirror, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("gcs bucket can't be empty")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = defaultGCSEndpoint
+	}
+	endpoint, err := validateURL(config.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "gcs endpoint validation")
+	}
+	return &gcsMirror{config: config, endpoint: endpoint, client: client}, nil
+}
+
+// Open downloads a target from the bucket.
+func (m *gcsMirror) Open(gun, target string) (io.ReadCloser, error) {
+	return m.OpenContext(context.Background(), gun, target)
+}
+
+// OpenContext downloads a target from the bucket, aborting if ctx is
+// canceled.
+func (m *gcsMirror) OpenContext(ctx context.Context, gun, target string) (io.ReadCloser, error) {
+	object := strings.TrimPrefix(path.Join(m.config.Prefix, gun, target), "/")
+	if m.config.SignURL != nil {
+		return openSignedURL(ctx, m.client, m.config.SignURL, m.config.Bucket, object)
+	}
+	u := *m.endpoint
+	u.Path = path.Join("/", u.Path, m.config.Bucket, object)
+	request, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating target request")
+	}
+	request.Header.Add(cacheControl, cachePolicyNoStore)
+	if m.config.Token != nil {
+		token, err := m.config.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "getting gcs access token")
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	return getTarget(ctx, m.client, request)
+}
@@ -0,0 +1,67 @@
+package tuf
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultHealthCheckTimeout = 1 * time.Minute
+
+var errHealthCheckTimeout = errors.New("health check timed out")
+
+// HealthCheck confirms that a newly installed autoupdate target works. It is
+// called with the path of the installed target before the NotificationHandler.
+// If it returns an error the previous version of the target is restored, the
+// NotificationHandler receives the error, and the failed version of the target
+// will not be installed again. The context is cancelled when the timeout passed
+// to WithHealthCheck expires.
+//
+// A HealthCheck may start the new version and wait for it to report that it is
+// running. Update and Download calls wait until the check is finished.
+type HealthCheck func(ctx context.Context, installedPath string) error
+
+// WithHealthCheck runs check against each new version of the autoupdate target.
+// If timeout is zero a default of one minute is used.
+func WithHealthCheck(check HealthCheck, timeout time.Duration) Option {
+	return func(c *Client) {
+		c.healthCheck = check
+		c.healthCheckTimeout = timeout
+	}
+}
+
+// ExecHealthCheck returns a HealthCheck which runs the installed target with
+// args, for example "--version", and fails if it does not exit successfully.
+// With WithArchiveExtraction the manifest must name the entry point to run.
+func ExecHealthCheck(args ...string) HealthCheck {
+	return func(ctx context.Context, installedPath string) error {
+		out, err := exec.CommandContext(ctx, installedPath, args...).CombinedOutput()
+		if err != nil {
+			return errors.Wrapf(err, "running %q: %s", installedPath, bytes.TrimSpace(out))
+		}
+		return nil
+	}
+}
+
+// runHealthCheck calls check, giving up when timeout expires even if check
+// ignores its context.
+func runHealthCheck(check HealthCheck, timeout time.Duration, installedPath string) error {
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	resultC := make(chan error, 1)
+	go func() {
+		resultC <- check(ctx, installedPath)
+	}()
+	select {
+	case err := <-resultC:
+		return err
+	case <-ctx.Done():
+		return errHealthCheckTimeout
+	}
+}
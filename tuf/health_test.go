@@ -0,0 +1,155 @@
+package tuf
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthCheckFailureReverts(t *testing.T) {
+	settings, stageDir, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	k := clock.NewMockClock(testTime)
+
+	installed := filepath.Join(stageDir, "edge", "target")
+	require.Nil(t, os.MkdirAll(filepath.Dir(installed), 0755))
+	require.Nil(t, ioutil.WriteFile(installed, []byte("working version"), 0755))
+
+	var (
+		path    string
+		cbErr   error
+		checked string
+	)
+	onUpdate := func(stagingPath string, err error) {
+		path = stagingPath
+		cbErr = err
+	}
+	unhealthy := func(ctx context.Context, installedPath string) error {
+		checked = installedPath
+		return errors.New("crashed on start")
+	}
+	client, err := NewClient(
+		settings, WithHTTPClient(testHTTPClient()),
+		withClock(k),
+		WithAutoUpdate("edge/target", stageDir, onUpdate),
+		WithHealthCheck(unhealthy, time.Second),
+	)
+	require.Nil(t, err)
+	client.Stop()
+
+	assert.Equal(t, installed, checked)
+	assert.Empty(t, path)
+	require.NotNil(t, cbErr)
+	assert.Contains(t, cbErr.Error(), "crashed on start")
+	// the previous version is back in place
+	buff, err := ioutil.ReadFile(installed)
+	require.Nil(t, err)
+	assert.Equal(t, "working version", string(buff))
+
+	// the failed version is not installed again, even after a restart
+	var called bool
+	onUpdate = func(stagingPath string, err error) {
+		called = true
+	}
+	client, err = NewClient(
+		settings, WithHTTPClient(testHTTPClient()),
+		withClock(k),
+		WithAutoUpdate("edge/target", stageDir, onUpdate),
+		WithHealthCheck(func(context.Context, string) error { return nil }, time.Second),
+	)
+	require.Nil(t, err)
+	client.Stop()
+	assert.False(t, called)
+}
+
+func TestHealthCheckFailureOnFirstInstall(t *testing.T) {
+	settings, stageDir, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+
+	var cbErr error
+	onUpdate := func(stagingPath string, err error) {
+		cbErr = err
+	}
+	hangs := func(ctx context.Context, installedPath string) error {
+		time.Sleep(time.Second)
+		return nil
+	}
+	client, err := NewClient(
+		settings, WithHTTPClient(testHTTPClient()),
+		withClock(clock.NewMockClock(testTime)),
+		WithAutoUpdate("edge/target", stageDir, onUpdate),
+		WithHealthCheck(hangs, 10*time.Millisecond),
+	)
+	require.Nil(t, err)
+	client.Stop()
+
+	require.NotNil(t, cbErr)
+	assert.Equal(t, errHealthCheckTimeout, errors.Cause(cbErr))
+	// with nothing to roll back to, the bad version is removed
+	_, err = os.Stat(filepath.Join(stageDir, "edge", "target"))
+	assert.True(t, os.IsNotExist(err))
+
+	state, err := loadAutoupdateState(stageDir)
+	require.Nil(t, err)
+	assert.Len(t, state.Rejected["edge/target"], 1)
+}
+
+func TestHealthCheckPasses(t *testing.T) {
+	settings, stageDir, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+
+	var (
+		path  string
+		cbErr error
+	)
+	onUpdate := func(stagingPath string, err error) {
+		path = stagingPath
+		cbErr = err
+	}
+	client, err := NewClient(
+		settings, WithHTTPClient(testHTTPClient()),
+		withClock(clock.NewMockClock(testTime)),
+		WithAutoUpdate("edge/target", stageDir, onUpdate),
+		WithHealthCheck(func(context.Context, string) error { return nil }, 0),
+	)
+	require.Nil(t, err)
+	client.Stop()
+
+	assert.Nil(t, cbErr)
+	assert.Equal(t, filepath.Join(stageDir, "edge", "target"), path)
+	state, err := loadAutoupdateState(stageDir)
+	require.Nil(t, err)
+	assert.Empty(t, state.Rejected)
+}
+
+func TestExecHealthCheck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell")
+	}
+	dir, err := ioutil.TempDir("", "health")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	good := filepath.Join(dir, "good")
+	require.Nil(t, ioutil.WriteFile(good, []byte("#!/bin/sh\n[ \"$1\" = \"--version\" ]\n"), 0755))
+	bad := filepath.Join(dir, "bad")
+	require.Nil(t, ioutil.WriteFile(bad, []byte("#!/bin/sh\necho broken\nexit 1\n"), 0755))
+
+	check := ExecHealthCheck("--version")
+	assert.Nil(t, runHealthCheck(check, time.Second, good))
+	err = runHealthCheck(check, time.Second, bad)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "broken")
+}
@@ -0,0 +1,138 @@
+package tuf
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	installedFileMode = 0755
+	previousSuffix    = ".previous"
+)
+
+var errNoPreviousVersion = errors.New("no previous version to roll back to")
+
+// Installer places verified targets in a directory. A new version of a
+// target is written to a temporary file next to its final location, verified,
+// flushed to disk and then renamed into place so that the installed file is
+// never partially written. The version being replaced is kept so that it can
+// be restored with Rollback.
+type Installer struct {
+	dir string
+}
+
+// NewInstaller creates an Installer that installs targets under dir.
+func NewInstaller(dir string) *Installer {
+	return &Installer{dir: dir}
+}
+
+// Path returns the location of an installed target.
+func (in *Installer) Path(targetName string) string {
+	return filepath.Join(in.dir, filepath.FromSlash(targetName))
+}
+
+// PreviousPath returns the location of the version of a target that was
+// replaced by the last Install.
+func (in *Installer) PreviousPath(targetName string) string {
+	return in.Path(targetName) + previousSuffix
+}
+
+// Install calls download to write a new version of targetName and installs
+// it if it matches fim. Errors returned by download are returned unchanged.
+// The installed file is executable. Install returns the path of the
+// installed file.
+func (in *Installer) Install(targetName string, fim FileIntegrityMeta, download func(io.Writer) error) (string, error) {
+	dst := in.Path(targetName)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", errors.Wrap(err, "creating install directory")
+	}
+	// The temporary file must be in the same directory as the destination
+	// for the final rename to be atomic.
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+".")
+	if err != nil {
+		return "", errors.Wrap(err, "creating temporary file for install")
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	if err := download(tmp); err != nil {
+		return "", err
+	}
+	// Check what actually landed on disk, not just what came over the wire.
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", errors.Wrap(err, "rewinding staged target")
+	}
+	if err := fim.verify(tmp); err != nil {
+		return "", errors.Wrap(err, "verifying staged target")
+	}
+	if err := tmp.Chmod(installedFileMode); err != nil {
+		return "", errors.Wrap(err, "setting staged target permissions")
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", errors.Wrap(err, "syncing staged target")
+	}
+	if err := tmp.Close(); err != nil {
+		return "", errors.Wrap(err, "closing staged target")
+	}
+	if err := in.keepPrevious(dst); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return "", errors.Wrap(err, "moving staged target into place")
+	}
+	syncDir(filepath.Dir(dst))
+	return dst, nil
+}
+
+// Rollback restores the version of targetName that was replaced by the last
+// Install. The previous version can only be restored once.
+func (in *Installer) Rollback(targetName string) error {
+	dst := in.Path(targetName)
+	prev := in.PreviousPath(targetName)
+	if _, err := os.Stat(prev); os.IsNotExist(err) {
+		return errNoPreviousVersion
+	}
+	if err := os.Rename(prev, dst); err != nil {
+		return errors.Wrapf(err, "rolling back %q", targetName)
+	}
+	syncDir(filepath.Dir(dst))
+	return nil
+}
+
+// keepPrevious preserves the currently installed file, if any, while leaving
+// it in place until the new version is renamed over it.
+func (in *Installer) keepPrevious(dst string) error {
+	if _, err := os.Stat(dst); os.IsNotExist(err) {
+		return nil
+	}
+	prev := dst + previousSuffix
+	if err := os.Remove(prev); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "removing old previous version")
+	}
+	// Hard links are not supported on every file system, fall back to a copy.
+	if err := os.Link(dst, prev); err != nil {
+		if err := copy(dst, prev); err != nil {
+			return errors.Wrap(err, "saving previous version")
+		}
+		if err := os.Chmod(prev, installedFileMode); err != nil {
+			return errors.Wrap(err, "setting previous version permissions")
+		}
+	}
+	return nil
+}
+
+// syncDir flushes directory entries so renames survive a crash. Not all
+// platforms support syncing a directory so errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -0,0 +1,121 @@
+package tuf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFIM(content []byte) FileIntegrityMeta {
+	sum := sha256.Sum256(content)
+	fim := newFileIntegrityMeta()
+	fim.Hashes[hashSHA256] = base64.StdEncoding.EncodeToString(sum[:])
+	fim.Length = int64(len(content))
+	return *fim
+}
+
+func writeContent(content []byte) func(io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := io.Copy(w, bytes.NewReader(content))
+		return err
+	}
+}
+
+func TestOmittedLengthOnlyAllowedForRoles(t *testing.T) {
+	content := []byte("content")
+	fim := testFIM(content)
+	fim.Length = 0
+	// a target without a length is never valid
+	err := fim.verify(bytes.NewReader(content))
+	assert.Equal(t, errLengthIncorrect, errors.Cause(err))
+	// roles listed in snapshot or timestamp may omit it, but not their hashes
+	assert.NoError(t, fim.verifyRole(bytes.NewReader(content)))
+	err = fim.verifyRole(bytes.NewReader([]byte("tampered")))
+	assert.Equal(t, errHashIncorrect, errors.Cause(err))
+	// a length that is given is always checked
+	fim.Length = int64(len(content)) + 1
+	err = fim.verifyRole(bytes.NewReader(content))
+	assert.Equal(t, errLengthIncorrect, errors.Cause(err))
+}
+
+func TestInstallAndRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "install")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	installer := NewInstaller(dir)
+
+	v1 := []byte("version one")
+	v2 := []byte("version two")
+
+	path, err := installer.Install("edge/target", testFIM(v1), writeContent(v1))
+	require.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "edge", "target"), path)
+	installed, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, v1, installed)
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(path)
+		require.Nil(t, err)
+		assert.Equal(t, os.FileMode(installedFileMode), fi.Mode().Perm())
+	}
+	// nothing to roll back to after the first install
+	assert.Equal(t, errNoPreviousVersion, installer.Rollback("edge/target"))
+
+	_, err = installer.Install("edge/target", testFIM(v2), writeContent(v2))
+	require.Nil(t, err)
+	installed, err = ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, v2, installed)
+	previous, err := ioutil.ReadFile(installer.PreviousPath("edge/target"))
+	require.Nil(t, err)
+	assert.Equal(t, v1, previous)
+
+	require.Nil(t, installer.Rollback("edge/target"))
+	installed, err = ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, v1, installed)
+	assert.Equal(t, errNoPreviousVersion, installer.Rollback("edge/target"))
+}
+
+func TestFailedInstallLeavesCurrentVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "install")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	installer := NewInstaller(dir)
+
+	v1 := []byte("version one")
+	v2 := []byte("version two")
+	path, err := installer.Install("target", testFIM(v1), writeContent(v1))
+	require.Nil(t, err)
+
+	downloadErr := errors.New("mirror unavailable")
+	_, err = installer.Install("target", testFIM(v2), func(w io.Writer) error {
+		w.Write(v2[:3])
+		return downloadErr
+	})
+	assert.Equal(t, downloadErr, err)
+
+	// content does not match the metadata
+	_, err = installer.Install("target", testFIM(v2), writeContent(v1))
+	require.NotNil(t, err)
+	assert.Equal(t, errHashIncorrect, errors.Cause(err))
+
+	installed, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, v1, installed)
+	// temporary files are cleaned up
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "target", files[0].Name())
+}
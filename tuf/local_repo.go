@@ -3,7 +3,7 @@ package tuf
 import (
 	"encoding/json"
 	"fmt"
-	"os"
+	"io/ioutil"
 	"path/filepath"
 
 	"github.com/pkg/errors"
@@ -14,15 +14,15 @@ type localTargetFetcher struct {
 }
 
 func (rdr *localTargetFetcher) fetch(role string) (*Targets, error) {
-	f, err := os.Open(filepath.Join(rdr.baseDir, fmt.Sprintf("%s.json", role)))
+	buff, err := ioutil.ReadFile(filepath.Join(rdr.baseDir, fmt.Sprintf("%s.json", role)))
 	if err != nil {
 		return nil, errors.Wrap(err, "local target read from file")
 	}
-	defer f.Close()
 	var result Targets
-	if err = json.NewDecoder(f).Decode(&result); err != nil {
+	if err = json.Unmarshal(buff, &result); err != nil {
 		return nil, errors.Wrap(err, "decoding json reading local target")
 	}
+	result.setRaw(buff)
 	return &result, nil
 }
 
@@ -61,15 +61,18 @@ func (r *localRepo) targets(fetcher roleFetcher) (*RootTarget, error) {
 	return rootTarget, nil
 }
 
-func (r *localRepo) getRole(name role, val interface{}) error {
+func (r *localRepo) getRole(name role, val rawer) error {
 	err := validateRole(name)
 	if err != nil {
 		return err
 	}
-	f, err := os.Open(filepath.Join(r.repoPath, fmt.Sprintf("%s.json", name)))
+	buff, err := ioutil.ReadFile(filepath.Join(r.repoPath, fmt.Sprintf("%s.json", name)))
 	if err != nil {
 		return errors.Wrap(err, "getting role")
 	}
-	defer f.Close()
-	return json.NewDecoder(f).Decode(val)
+	if err := json.Unmarshal(buff, val); err != nil {
+		return err
+	}
+	val.setRaw(buff)
+	return nil
 }
@@ -0,0 +1,111 @@
+package tuf
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// mirror retrieves target files. The contents are not trusted until they are
+// verified against the targets metadata.
+type mirror interface {
+	open(ctx context.Context, target string) (io.ReadCloser, error)
+}
+
+// MirrorTransport retrieves target files from a mirror that isn't a plain
+// https server, for example a private object storage bucket. Open returns the
+// contents of target in the repository identified by gun. The contents are
+// verified against the TUF targets metadata after they are read, so a
+// MirrorTransport does not need to verify them.
+type MirrorTransport interface {
+	Open(gun, target string) (io.ReadCloser, error)
+}
+
+// ContextMirrorTransport is a MirrorTransport that stops opening a target
+// when ctx is canceled, which happens when the download exceeds its deadline
+// or minimum throughput. A MirrorTransport that doesn't implement it can only
+// be aborted once Open has returned.
+type ContextMirrorTransport interface {
+	MirrorTransport
+	OpenContext(ctx context.Context, gun, target string) (io.ReadCloser, error)
+}
+
+// MirrorTransportFunc allows an ordinary function to be used as a
+// MirrorTransport.
+type MirrorTransportFunc func(gun, target string) (io.ReadCloser, error)
+
+// Open calls f(gun, target).
+func (f MirrorTransportFunc) Open(gun, target string) (io.ReadCloser, error) {
+	return f(gun, target)
+}
+
+// WithMirrorTransport downloads targets using transport, in which case the
+// MirrorURL setting is not used. See WithS3Mirror and WithGCSMirror.
+func WithMirrorTransport(transport MirrorTransport) Option {
+	return func(c *Client) {
+		c.newMirrorTransport = func(*Client) (MirrorTransport, error) {
+			return transport, nil
+		}
+	}
+}
+
+// transportMirror adapts a MirrorTransport to a mirror.
+type transportMirror struct {
+	transport MirrorTransport
+	gun       string
+}
+
+func (m *transportMirror) open(ctx context.Context, target string) (io.ReadCloser, error) {
+	if transport, ok := m.transport.(ContextMirrorTransport); ok {
+		return transport.OpenContext(ctx, m.gun, target)
+	}
+	return m.transport.Open(m.gun, target)
+}
+
+// httpsMirror fetches targets from a web server, where they are expected to
+// be located at https://mirror.com/gun/targetname
+type httpsMirror struct {
+	url    *url.URL
+	gun    string
+	client *http.Client
+}
+
+func newHTTPSMirror(settings *Settings, client *http.Client) (*httpsMirror, error) {
+	u, err := validateURL(settings.MirrorURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "mirror url validation")
+	}
+	return &httpsMirror{url: u, gun: settings.GUN, client: client}, nil
+}
+
+func (m *httpsMirror) open(ctx context.Context, target string) (io.ReadCloser, error) {
+	mirrorURL := *m.url
+	mirrorURL.Path = path.Join(mirrorURL.Path, m.gun, target)
+	request, err := http.NewRequest(http.MethodGet, mirrorURL.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating target request")
+	}
+	// Dissallow caching because if we are making this call, we know that the target
+	// has changed and we want to make sure we get the data from the mirror, not
+	// from cache.
+	request.Header.Add(cacheControl, cachePolicyNoStore)
+	return getTarget(ctx, m.client, request)
+}
+
+// getTarget performs a request for a target file, returning the response body
+// if the request succeeded. The request is aborted if ctx is canceled.
+func getTarget(ctx context.Context, client *http.Client, request *http.Request) (io.ReadCloser, error) {
+	resp, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("get target returned %q", resp.Status)
+	}
+	return resp.Body, nil
+}
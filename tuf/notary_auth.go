@@ -0,0 +1,342 @@
+package tuf
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/pkg/errors"
+)
+
+// Notary servers are often deployed behind Docker registry token
+// authentication. A request without a token is answered with
+// 401 Unauthorized and a challenge such as
+//
+//	WWW-Authenticate: Bearer realm="https://auth.example.com/token",service="notary",scope="repository:kolide/launcher:pull"
+//
+// The client then requests a token from the realm, authenticating with its
+// credentials, and repeats the request with the token as a bearer token.
+// See https://docs.docker.com/registry/spec/auth/token/
+
+const (
+	// Tokens without an expiration are valid for 60 seconds.
+	defaultTokenLifetime = 60 * time.Second
+	maxTokenResponseSize = 1024 * 1024
+)
+
+// AuthChallenge contains the parameters of a bearer token challenge.
+type AuthChallenge struct {
+	Realm   string
+	Service string
+	Scope   string
+}
+
+// Credentials are used to authenticate to a token server. If Token is set it
+// is used as the bearer token and no token server is contacted, otherwise a
+// token is requested from the token server using Username and Password.
+// Tokens are requested anonymously if Username is empty.
+type Credentials struct {
+	Username string
+	Password string
+	Token    string
+}
+
+// CredentialProvider returns the credentials to use to answer challenge.
+type CredentialProvider interface {
+	Credentials(challenge AuthChallenge) (Credentials, error)
+}
+
+// CredentialProviderFunc allows an ordinary function to be used as a
+// CredentialProvider, for example to look up credentials in a keychain.
+type CredentialProviderFunc func(challenge AuthChallenge) (Credentials, error)
+
+// Credentials calls f(challenge).
+func (f CredentialProviderFunc) Credentials(challenge AuthChallenge) (Credentials, error) {
+	return f(challenge)
+}
+
+// StaticToken returns a CredentialProvider which always uses token as the
+// bearer token.
+func StaticToken(token string) CredentialProvider {
+	return CredentialProviderFunc(func(AuthChallenge) (Credentials, error) {
+		return Credentials{Token: token}, nil
+	})
+}
+
+// BasicCredentials returns a CredentialProvider which requests tokens using
+// username and password.
+func BasicCredentials(username, password string) CredentialProvider {
+	return CredentialProviderFunc(func(AuthChallenge) (Credentials, error) {
+		return Credentials{Username: username, Password: password}, nil
+	})
+}
+
+// WithNotaryAuth answers bearer token challenges from Notary with
+// credentials from provider. Tokens are cached until they expire. Only
+// requests to Notary are authenticated, not requests to the mirror.
+func WithNotaryAuth(provider CredentialProvider) Option {
+	return func(c *Client) {
+		c.notaryAuth = provider
+	}
+}
+
+// notaryClient returns the http client used for requests to Notary.
+func (c *Client) notaryClient() *http.Client {
+	if c.notaryAuth == nil {
+		return c.client
+	}
+	client := *c.client
+	client.Transport = newTokenTransport(c.client.Transport, c.notaryAuth, c.clock)
+	return &client
+}
+
+type bearerToken struct {
+	token   string
+	expires time.Time
+}
+
+// tokenTransport is an http.RoundTripper that answers bearer token
+// challenges.
+type tokenTransport struct {
+	base     http.RoundTripper
+	provider CredentialProvider
+	clock    clock.Clock
+
+	mtx sync.Mutex
+	// challenges holds the last challenge received from each host, so that
+	// requests can be authenticated before the server asks.
+	challenges map[string]AuthChallenge
+	tokens     map[AuthChallenge]bearerToken
+}
+
+func newTokenTransport(base http.RoundTripper, provider CredentialProvider, k clock.Clock) *tokenTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &tokenTransport{
+		base:       base,
+		provider:   provider,
+		clock:      k,
+		challenges: make(map[string]AuthChallenge),
+		tokens:     make(map[AuthChallenge]bearerToken),
+	}
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.tryCachedToken(req)
+	if resp == nil && err == nil {
+		resp, err = t.base.RoundTrip(req)
+	}
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge, ok := parseBearerChallenge(resp.Header.Get("WWW-Authenticate"))
+	if !ok || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+	resp.Body.Close()
+	token, err := t.token(req.Context(), challenge)
+	if err != nil {
+		return nil, errors.Wrap(err, "authenticating to notary")
+	}
+	t.mtx.Lock()
+	t.challenges[req.URL.Host] = challenge
+	t.mtx.Unlock()
+	retry := withBearer(req, token)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.base.RoundTrip(retry)
+}
+
+// tryCachedToken sends req with the cached token for its host. A token that
+// is refused, because it was revoked or expired early, is forgotten so that
+// the challenge in the response is answered with a new token. The response
+// is nil if there is no cached token.
+func (t *tokenTransport) tryCachedToken(req *http.Request) (*http.Response, error) {
+	challenge, ok := t.lastChallenge(req.URL.Host)
+	if !ok {
+		return nil, nil
+	}
+	token, ok := t.cachedToken(challenge)
+	if !ok {
+		return nil, nil
+	}
+	resp, err := t.base.RoundTrip(withBearer(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	t.mtx.Lock()
+	if cached, ok := t.tokens[challenge]; ok && cached.token == token {
+		delete(t.tokens, challenge)
+	}
+	t.mtx.Unlock()
+	return resp, nil
+}
+
+func (t *tokenTransport) lastChallenge(host string) (AuthChallenge, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	challenge, ok := t.challenges[host]
+	return challenge, ok
+}
+
+func (t *tokenTransport) cachedToken(challenge AuthChallenge) (string, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	token, ok := t.tokens[challenge]
+	if !ok || !t.clock.Now().Before(token.expires) {
+		return "", false
+	}
+	return token.token, true
+}
+
+// token returns a token for challenge, requesting a new one from the token
+// server unless a cached token is still valid. The request for a new token is
+// canceled along with ctx, the context of the request that was challenged,
+// so it is bound by the same retrieval limits.
+func (t *tokenTransport) token(ctx context.Context, challenge AuthChallenge) (string, error) {
+	if token, ok := t.cachedToken(challenge); ok {
+		return token, nil
+	}
+	creds, err := t.provider.Credentials(challenge)
+	if err != nil {
+		return "", errors.Wrap(err, "getting credentials")
+	}
+	var token bearerToken
+	if creds.Token != "" {
+		token = bearerToken{token: creds.Token, expires: t.clock.Now().Add(defaultTokenLifetime)}
+	} else if token, err = t.requestToken(ctx, challenge, creds); err != nil {
+		return "", err
+	}
+	t.mtx.Lock()
+	t.tokens[challenge] = token
+	t.mtx.Unlock()
+	return token.token, nil
+}
+
+type tokenResponse struct {
+	Token       string    `json:"token"`
+	AccessToken string    `json:"access_token"`
+	ExpiresIn   int       `json:"expires_in"`
+	IssuedAt    time.Time `json:"issued_at"`
+}
+
+func (t *tokenTransport) requestToken(ctx context.Context, challenge AuthChallenge, creds Credentials) (bearerToken, error) {
+	realm, err := validateURL(challenge.Realm)
+	if err != nil {
+		return bearerToken{}, errors.Wrap(err, "token realm validation")
+	}
+	query := realm.Query()
+	if challenge.Service != "" {
+		query.Set("service", challenge.Service)
+	}
+	if challenge.Scope != "" {
+		query.Set("scope", challenge.Scope)
+	}
+	realm.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return bearerToken{}, errors.Wrap(err, "creating token request")
+	}
+	if creds.Username != "" {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+	requested := t.clock.Now()
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return bearerToken{}, errors.Wrap(err, "requesting token")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxTokenResponseSize))
+		return bearerToken{}, errors.Errorf("token server returned %q", resp.Status)
+	}
+	var tr tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxTokenResponseSize)).Decode(&tr); err != nil {
+		return bearerToken{}, errors.Wrap(err, "decoding token response")
+	}
+	token := bearerToken{token: tr.Token}
+	if token.token == "" {
+		token.token = tr.AccessToken
+	}
+	if token.token == "" {
+		return bearerToken{}, errors.New("token server did not return a token")
+	}
+	lifetime := defaultTokenLifetime
+	if tr.ExpiresIn > 0 {
+		lifetime = time.Duration(tr.ExpiresIn) * time.Second
+	}
+	// The clock of the token server may not agree with ours, so expiration is
+	// measured from when the token was requested.
+	token.expires = requested.Add(lifetime)
+	return token, nil
+}
+
+func withBearer(req *http.Request, token string) *http.Request {
+	authed := req.Clone(req.Context())
+	authed.Header.Set("Authorization", "Bearer "+token)
+	return authed
+}
+
+// parseBearerChallenge parses a WWW-Authenticate header value with the
+// Bearer scheme.
+func parseBearerChallenge(header string) (AuthChallenge, bool) {
+	const scheme = "bearer "
+	if len(header) < len(scheme) || !strings.EqualFold(header[:len(scheme)], scheme) {
+		return AuthChallenge{}, false
+	}
+	params := make(map[string]string)
+	rest := strings.TrimSpace(header[len(scheme):])
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				b.WriteByte(rest[i])
+			}
+			value = b.String()
+			if i < len(rest) {
+				i++
+			}
+			rest = rest[i:]
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				end = len(rest)
+			}
+			value = strings.TrimSpace(rest[:end])
+			rest = rest[end:]
+		}
+		params[key] = value
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+		rest = strings.TrimSpace(rest)
+	}
+	challenge := AuthChallenge{
+		Realm:   params["realm"],
+		Service: params["service"],
+		Scope:   params["scope"],
+	}
+	if challenge.Realm == "" {
+		return AuthChallenge{}, false
+	}
+	return challenge, true
+}
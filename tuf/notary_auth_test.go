@@ -0,0 +1,130 @@
+package tuf
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBearerChallenge(t *testing.T) {
+	challenge, ok := parseBearerChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:samalba/my-app:pull,push"`)
+	require.True(t, ok)
+	assert.Equal(t, AuthChallenge{
+		Realm:   "https://auth.docker.io/token",
+		Service: "registry.docker.io",
+		Scope:   "repository:samalba/my-app:pull,push",
+	}, challenge)
+
+	challenge, ok = parseBearerChallenge(`bearer realm=https://auth.example.com/token, service=notary`)
+	require.True(t, ok)
+	assert.Equal(t, AuthChallenge{Realm: "https://auth.example.com/token", Service: "notary"}, challenge)
+
+	_, ok = parseBearerChallenge(`Basic realm="notary"`)
+	assert.False(t, ok)
+	_, ok = parseBearerChallenge(`Bearer service="notary"`)
+	assert.False(t, ok)
+}
+
+// authenticatedNotary puts a notary server behind token authentication. The
+// token server issues tokens valid for a minute to user:secret.
+func authenticatedNotary(t *testing.T, notaryURL string) (svr *httptest.Server, tokenRequests *int32) {
+	tokenRequests = new(int32)
+	var issued int32
+	tokens := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(tokenRequests, 1)
+		user, password, _ := r.BasicAuth()
+		if user != "user" || password != "secret" || r.URL.Query().Get("scope") != "repository:"+testGUN+":pull" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"token":"token-%d","expires_in":60}`, atomic.AddInt32(&issued, 1))
+	}))
+	target, err := url.Parse(notaryURL)
+	require.NoError(t, err)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = testHTTPClient().Transport
+	svr = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if auth != "Bearer static" && auth != fmt.Sprintf("Bearer token-%d", atomic.LoadInt32(&issued)) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="%s/token",service="notary",scope="repository:%s:pull"`, tokens.URL, testGUN))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	return svr, tokenRequests
+}
+
+func TestNotaryAuth(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	k := clock.NewMockClock(testTime)
+	settings, _, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	svr, tokenRequests := authenticatedNotary(t, settings.NotaryURL)
+	defer svr.Close()
+	settings.NotaryURL = svr.URL
+
+	_, err := NewClient(settings, WithHTTPClient(testHTTPClient()), withClock(k))
+	require.Error(t, err)
+	_, err = NewClient(settings, WithHTTPClient(testHTTPClient()), withClock(k), WithNotaryAuth(BasicCredentials("user", "wrong")))
+	require.Error(t, err)
+
+	var challenges []AuthChallenge
+	provider := CredentialProviderFunc(func(challenge AuthChallenge) (Credentials, error) {
+		challenges = append(challenges, challenge)
+		return Credentials{Username: "user", Password: "secret"}, nil
+	})
+	atomic.StoreInt32(tokenRequests, 0)
+	client, err := NewClient(settings, WithHTTPClient(testHTTPClient()), withClock(k), WithNotaryAuth(provider))
+	require.NoError(t, err)
+	defer client.Stop()
+	_, _, err = client.Update()
+	require.NoError(t, err)
+	// the token is cached until it expires
+	assert.Equal(t, int32(1), atomic.LoadInt32(tokenRequests))
+	require.Len(t, challenges, 1)
+	assert.Equal(t, "notary", challenges[0].Service)
+
+	k.AddTime(2 * time.Minute)
+	_, _, err = client.Update()
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(tokenRequests))
+
+	// issuing another token revokes the cached one, which is replaced
+	revoke, err := http.NewRequest(http.MethodGet, challenges[0].Realm+"?scope=repository:"+testGUN+":pull", nil)
+	require.NoError(t, err)
+	revoke.SetBasicAuth("user", "secret")
+	resp, err := testHTTPClient().Do(revoke)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	_, _, err = client.Update()
+	require.NoError(t, err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(tokenRequests))
+}
+
+func TestNotaryAuthStaticToken(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	settings, _, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	svr, tokenRequests := authenticatedNotary(t, settings.NotaryURL)
+	defer svr.Close()
+	settings.NotaryURL = svr.URL
+
+	client, err := NewClient(settings, WithHTTPClient(testHTTPClient()), withClock(clock.NewMockClock(testTime)), WithNotaryAuth(StaticToken("static")))
+	require.NoError(t, err)
+	defer client.Stop()
+	_, _, err = client.Update()
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), atomic.LoadInt32(tokenRequests))
+}
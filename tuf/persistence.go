@@ -15,6 +15,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/WatchBeam/clock"
 	cjson "github.com/docker/go/canonical/json"
 	"github.com/pkg/errors"
 )
@@ -78,7 +79,7 @@ func restoreTUFRepo(tufRoot, tag string) error {
 }
 
 // Remove backups files that are older than the time duration specified by age.
-func removeAgedBackups(tufRoot string, age time.Duration) error {
+func removeAgedBackups(tufRoot string, age time.Duration, k clock.Clock) error {
 	if err := checkForDirectoryPresence(tufRoot); err != nil {
 		return err
 	}
@@ -97,7 +98,7 @@ func removeAgedBackups(tufRoot string, age time.Duration) error {
 					return err
 				}
 				expirationTime := backupTime.Add(age)
-				if time.Now().UTC().After(expirationTime) {
+				if k.Now().UTC().After(expirationTime) {
 					if err = os.Remove(path); err != nil {
 						return err
 					}
@@ -111,6 +112,7 @@ func removeAgedBackups(tufRoot string, age time.Duration) error {
 type saveSettings struct {
 	tufRepositoryRootDir string
 	backupAge            time.Duration
+	clock                clock.Clock
 	rootRole             *Root
 	snapshotRole         *Snapshot
 	timestampRole        *Timestamp
@@ -125,9 +127,9 @@ type saveSettings struct {
 // original state.
 func saveTufRepository(ss *saveSettings) (err error) {
 	// Create a timestamp tag to group backup files.
-	tag := time.Now().UTC().Format(backupFileTimeTagFormat)
+	tag := ss.clock.Now().UTC().Format(backupFileTimeTagFormat)
 	// See if we have any old backup files hanging around and get rid of them.
-	if err = removeAgedBackups(ss.tufRepositoryRootDir, ss.backupAge); err != nil {
+	if err = removeAgedBackups(ss.tufRepositoryRootDir, ss.backupAge, ss.clock); err != nil {
 		return errors.Wrap(err, "saving roles")
 	}
 	// Make a new backup of the local TUF repository.
@@ -195,9 +197,15 @@ func saveRole(tufRoot, roleName string, val interface{}) error {
 	} else {
 		fileName = fmt.Sprintf("%s.json", roleName)
 	}
-	buff, err := cjson.MarshalCanonical(val)
-	if err != nil {
-		return errors.Wrap(err, "marshalling role")
+	var buff []byte
+	if r, ok := val.(rawer); ok {
+		buff = r.rawBytes()
+	}
+	if len(buff) == 0 {
+		var err error
+		if buff, err = cjson.MarshalCanonical(val); err != nil {
+			return errors.Wrap(err, "marshalling role")
+		}
 	}
 	rolePath := filepath.Join(tufRoot, fileName)
 	return ioutil.WriteFile(rolePath, buff, 0644)
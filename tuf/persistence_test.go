@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/WatchBeam/clock"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -124,7 +125,7 @@ func TestBackupAndRecovery(t *testing.T) {
 		})
 	}
 	// It should remove the old backups, leave the newer ones
-	err = removeAgedBackups(repoDir, 60*time.Minute)
+	err = removeAgedBackups(repoDir, 60*time.Minute, &clock.DefaultClock{})
 
 	for _, name := range repoFileNames {
 		oldBackup := strings.Replace(name, ".json", fmt.Sprintf(".%s.json", olderBackupTag), 1)
@@ -165,6 +166,7 @@ func TestSaveWithTargetTree(t *testing.T) {
 	ss := saveSettings{
 		tufRepositoryRootDir: repoDir,
 		backupAge:            defaultBackupAge,
+		clock:                &clock.DefaultClock{},
 		rootRole:             root,
 		snapshotRole:         snapshot,
 		timestampRole:        timestamp,
@@ -0,0 +1,83 @@
+package tuf
+
+import (
+	"io"
+	"time"
+
+	"github.com/WatchBeam/clock"
+)
+
+// progressInterval is the minimum time between progress reports for a
+// download, other than the first and last.
+const progressInterval = time.Second
+
+// Progress describes a target download in progress.
+type Progress struct {
+	Target string
+	// BytesRead is the number of bytes downloaded so far.
+	BytesRead int64
+	// TotalBytes is the size of the target from the targets metadata.
+	TotalBytes int64
+	// BytesPerSecond is the average rate since the download started.
+	BytesPerSecond float64
+	// Elapsed is the time since the download started.
+	Elapsed time.Duration
+}
+
+// ProgressHandler is called when a download starts, periodically while it
+// is in progress and when it finishes. It is called from the goroutine doing
+// the download, so it should return quickly.
+type ProgressHandler func(Progress)
+
+// WithProgress reports the progress of target downloads, both from Download
+// and from the autoupdater, to handler.
+func WithProgress(handler ProgressHandler) Option {
+	return func(c *Client) {
+		c.progress = handler
+	}
+}
+
+// progressReader reports progress as bytes are read.
+type progressReader struct {
+	rdr      io.Reader
+	handler  ProgressHandler
+	clock    clock.Clock
+	progress Progress
+	started  time.Time
+	reported time.Time
+	done     bool
+}
+
+func newProgressReader(rdr io.Reader, target string, total int64, handler ProgressHandler, k clock.Clock) *progressReader {
+	pr := &progressReader{
+		rdr:      rdr,
+		handler:  handler,
+		clock:    k,
+		progress: Progress{Target: target, TotalBytes: total},
+		started:  k.Now(),
+	}
+	pr.report(pr.started)
+	return pr
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.rdr.Read(p)
+	pr.progress.BytesRead += int64(n)
+	now := pr.clock.Now()
+	finished := err == io.EOF || pr.progress.BytesRead >= pr.progress.TotalBytes
+	if !pr.done && (finished || now.Sub(pr.reported) >= progressInterval) {
+		pr.done = finished
+		pr.report(now)
+	}
+	return n, err
+}
+
+func (pr *progressReader) report(now time.Time) {
+	pr.reported = now
+	pr.progress.Elapsed = now.Sub(pr.started)
+	pr.progress.BytesPerSecond = 0
+	if pr.progress.Elapsed > 0 {
+		pr.progress.BytesPerSecond = float64(pr.progress.BytesRead) / pr.progress.Elapsed.Seconds()
+	}
+	pr.handler(pr.progress)
+}
@@ -0,0 +1,76 @@
+package tuf
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowReader returns one byte per read, advancing the clock by delay.
+type slowReader struct {
+	rdr   io.Reader
+	clock *clock.MockClock
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	r.clock.AddTime(r.delay)
+	return r.rdr.Read(p[:1])
+}
+
+func TestProgressReader(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	k := clock.NewMockClock(testTime)
+	var reports []Progress
+	rdr := &slowReader{rdr: bytes.NewReader([]byte("0123456789")), clock: k, delay: 400 * time.Millisecond}
+	_, err := ioutil.ReadAll(newProgressReader(rdr, "target", 10, func(p Progress) {
+		reports = append(reports, p)
+	}, k))
+	require.NoError(t, err)
+
+	// start, every third byte when a second has passed, and the end
+	require.Len(t, reports, 5)
+	assert.Equal(t, Progress{Target: "target", TotalBytes: 10}, reports[0])
+	assert.Equal(t, int64(3), reports[1].BytesRead)
+	assert.Equal(t, 1200*time.Millisecond, reports[1].Elapsed)
+	assert.Equal(t, 2.5, reports[1].BytesPerSecond)
+	last := reports[len(reports)-1]
+	assert.Equal(t, int64(10), last.BytesRead)
+	assert.Equal(t, 4*time.Second, last.Elapsed)
+}
+
+func TestDownloadProgress(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	settings, stageDir, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	expected := int64(len(testAsset(t, path.Join(mirrorRoot, "2", "edge", "target"))))
+
+	var reports []Progress
+	client, err := NewClient(
+		settings, WithHTTPClient(testHTTPClient()),
+		withClock(clock.NewMockClock(testTime)),
+		WithProgress(func(p Progress) {
+			reports = append(reports, p)
+		}),
+		WithAutoUpdate("edge/target", stageDir, func(string, error) {}),
+	)
+	require.NoError(t, err)
+	require.NoError(t, client.Download("edge/target", ioutil.Discard))
+	client.Stop()
+
+	// autoupdate and Download each report the start and the end
+	require.Len(t, reports, 4)
+	for _, p := range reports {
+		assert.Equal(t, "edge/target", p.Target)
+		assert.Equal(t, expected, p.TotalBytes)
+	}
+	assert.Equal(t, int64(0), reports[2].BytesRead)
+	assert.Equal(t, expected, reports[3].BytesRead)
+}
@@ -2,6 +2,7 @@ package tuf
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,32 +14,27 @@ import (
 )
 
 type notaryTargetFetcherSettings struct {
-	gun             string
-	url             string
+	remote remoteRepo
+	// maxResponseSize limits roles that the snapshot doesn't list a length for
 	maxResponseSize int64
-	client          *http.Client
 	rootRole        *Root
 	snapshotRole    *Snapshot
 	localRootTarget *RootTarget
 	clock           clock.Clock
 }
 
+// notaryTargetFetcher reads targets roles from a remote repository, which is
+// usually Notary, verifying each one as it is read.
 type notaryTargetFetcher struct {
 	settings *notaryTargetFetcherSettings
-	url      *url.URL
 	seen     map[string]struct{}
 	keys     map[keyID]Key
 	roles    map[string]Role
 }
 
 func newNotaryTargetFetcher(settings *notaryTargetFetcherSettings) (*notaryTargetFetcher, error) {
-	u, err := url.Parse(settings.url)
-	if err != nil {
-		return nil, errors.Wrap(err, "instantianting remote target reader")
-	}
 	rdr := &notaryTargetFetcher{
 		settings: settings,
-		url:      u,
 		seen:     make(map[string]struct{}),
 		keys:     make(map[keyID]Key),
 		roles:    make(map[string]Role),
@@ -70,39 +66,40 @@ func (rdr *notaryTargetFetcher) fetch(delegate string) (*Targets, error) {
 		return nil, errTargetSeen
 	}
 	rdr.seen[delegate] = struct{}{}
-	path, err := url.Parse(fmt.Sprintf(tufAPIFormat, rdr.settings.gun, delegate))
-	if err != nil {
-		return nil, errors.Wrap(err, "bad url in remote target read")
-	}
-	roleLocation := rdr.url.ResolveReference(path).String()
-	resp, err := rdr.settings.client.Get(roleLocation)
+	body, err := rdr.settings.remote.openRole(delegate)
 	if err != nil {
 		return nil, errors.Wrap(err, "fetching remote target")
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.Errorf("notary server request status %q", resp.Status)
-	}
+	defer body.Close()
 	// get hashes and length from snapshot for step 4.1
 	fim, ok := rdr.settings.snapshotRole.Signed.Meta[role(delegate)]
 	if !ok {
 		return nil, errors.Errorf("fim data missing for %q", delegate)
 	}
-	inStream := io.LimitReader(resp.Body, fim.Length)
+	limit := fim.Length
+	if limit == 0 {
+		limit = rdr.settings.maxResponseSize
+	}
+	inStream := io.LimitReader(body, limit)
 	var validated bytes.Buffer
 	// 4.1. **Check against snapshot metadata.** The hashes (if any), and version
 	// number of this metadata file MUST match the snapshot metadata. This is
 	// done, in part, to prevent a mix-and-match attack by man-in-the-middle
 	// attackers.
-	err = fim.verify(io.TeeReader(inStream, &validated))
+	err = fim.verifyRole(io.TeeReader(inStream, &validated))
 	if err != nil {
 		return nil, errors.Wrapf(err, "file integrity checks failed for %q", delegate)
 	}
 	var target Targets
+	target.setRaw(validated.Bytes())
 	err = json.NewDecoder(&validated).Decode(&target)
 	if err != nil {
 		return nil, errors.Wrap(err, "target json could not be decoded")
 	}
+	// 4.1. The version number MUST match the snapshot metadata, if it is listed.
+	if fim.Version > 0 && fim.Version != target.Signed.Version {
+		return nil, errors.Wrapf(errVersionIncorrect, "checking %q against snapshot", delegate)
+	}
 	role, ok := rdr.roles[delegate]
 	if !ok {
 		return nil, errors.Errorf("unable to find role info for %q", delegate)
@@ -201,28 +198,48 @@ func (r *notaryRepo) snapshot(opts ...repoOption) (*Snapshot, error) {
 
 // Returns nil if notary server is responding
 func (r *notaryRepo) ping() error {
-	path, err := url.Parse(healthzPath)
+	resp, err := r.health()
 	if err != nil {
 		return errors.Wrap(err, "ping")
 	}
-	pingURL := r.url.ResolveReference(path).String()
-
-	resp, err := r.client.Get(pingURL)
-	if err != nil {
-		return errors.Wrap(err, "ping")
-	}
-	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return errors.Errorf("notary ping failed with %q", resp.Status)
 	}
 	return nil
 }
 
+// health requests the health check of the notary server, subject to the same
+// limits as downloading a role. The body of the response is closed.
+func (r *notaryRepo) health() (*http.Response, error) {
+	path, err := url.Parse(healthzPath)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(http.MethodGet, r.url.ResolveReference(path).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := startWatchdog(r.limits, cancel)
+	defer w.stop()
+	resp, err := r.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, w.err(err)
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
 func (r *notaryRepo) buildRoleURL(roleName role) (string, error) {
 	err := validateRole(roleName)
 	if err != nil {
 		return "", err
 	}
+	return r.roleURL(string(roleName))
+}
+
+func (r *notaryRepo) roleURL(roleName string) (string, error) {
 	path, err := url.Parse(fmt.Sprintf(tufAPIFormat, r.gun, roleName))
 	if err != nil {
 		return "", errors.Wrap(err, "building path for remote repo")
@@ -230,8 +247,54 @@ func (r *notaryRepo) buildRoleURL(roleName role) (string, error) {
 	return r.url.ResolveReference(path).String(), nil
 }
 
+// openRole returns the body of a role. Delegate roles are allowed, so the
+// role name is not validated here. Returns errNotFound if the role does not
+// exist.
+func (r *notaryRepo) openRole(roleName string) (io.ReadCloser, error) {
+	roleURL, err := r.roleURL(roleName)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(http.MethodGet, roleURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating role request")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := startWatchdog(r.limits, cancel)
+	resp, err := r.client.Do(request.WithContext(ctx))
+	if err != nil {
+		w.stop()
+		cancel()
+		return nil, errors.Wrap(w.err(err), "fetching role from remote repo")
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		w.stop()
+		cancel()
+		// It's legitimate not to find roles in some circumstances
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, errNotFound
+		}
+		return nil, errors.Errorf("notary server error %q", resp.Status)
+	}
+	return &cancelingBody{ReadCloser: w.watch(resp.Body), cancel: cancel}, nil
+}
+
 func (r *notaryRepo) getRole(roleName role, role interface{}, opts ...repoOption) error {
-	maxResponseSize := r.maxResponseSize
+	if err := validateRole(roleName); err != nil {
+		return errors.Wrap(err, "getting remote role")
+	}
+	body, err := r.openRole(string(roleName))
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return decodeRole(body, r.sizeLimits.forRole(string(roleName)), role, opts...)
+}
+
+// decodeRole reads a role from a remote repository, applying size limits and
+// any tests from opts before decoding it into role.
+func decodeRole(body io.Reader, maxResponseSize int64, role interface{}, opts ...repoOption) error {
 	var testers []tester
 	var optVal repoOptions
 	for _, opt := range opts {
@@ -243,27 +306,11 @@ func (r *notaryRepo) getRole(roleName role, role interface{}, opts ...repoOption
 	if len(optVal.roleOptions.tests) > 0 {
 		testers = optVal.roleOptions.tests
 	}
-	roleURL, err := r.buildRoleURL(roleName)
-	if err != nil {
-		return errors.Wrap(err, "getting remote role")
-	}
-	resp, err := r.client.Get(roleURL)
-	if err != nil {
-		return errors.Wrap(err, "fetching role from remote repo")
-	}
-	defer resp.Body.Close()
 	// Read up to a number of bytes. The can be specified from the previous role,
-	// or in the case of root no more than defaultMaxResponseSize
-	limitedReader := io.LimitReader(resp.Body, maxResponseSize)
-	if resp.StatusCode != http.StatusOK {
-		// It's legitimate not to find roles in some circumstances
-		if resp.StatusCode == http.StatusNotFound {
-			return errNotFound
-		}
-		return errors.Wrap(err, "notary server error")
-	}
+	// or otherwise no more than the size limit for the role
+	limitedReader := io.LimitReader(body, maxResponseSize)
 	var buff bytes.Buffer
-	_, err = io.Copy(&buff, limitedReader)
+	_, err := io.Copy(&buff, limitedReader)
 	if err != nil {
 		return errors.Wrap(err, "reading response from notary")
 	}
@@ -273,6 +320,9 @@ func (r *notaryRepo) getRole(roleName role, role interface{}, opts ...repoOption
 			return errors.Wrap(err, "validating response from notary")
 		}
 	}
+	if r, ok := role.(rawer); ok {
+		r.setRaw(buff.Bytes())
+	}
 	err = json.NewDecoder(&buff).Decode(role)
 	if err != nil {
 		return errors.Wrap(err, "parsing json returned from server")
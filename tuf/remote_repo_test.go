@@ -71,9 +71,9 @@ func TestGetRemoteRole(t *testing.T) {
 
 		baseURL, _ := url.Parse(svr.URL)
 		r := notaryRepo{
-			gun:             "kolide/agent/darwin",
-			url:             baseURL,
-			maxResponseSize: defaultMaxResponseSize,
+			gun:        "kolide/agent/darwin",
+			url:        baseURL,
+			sizeLimits: defaultSizeLimits,
 			client: &http.Client{
 				Transport: &http.Transport{
 					TLSClientConfig: &tls.Config{
@@ -113,9 +113,9 @@ func TestTheReadSizeLimitsAreEnforced(t *testing.T) {
 
 	baseURL, _ := url.Parse(svr.URL)
 	r := notaryRepo{
-		gun:             "kolide/agent/darwin",
-		url:             baseURL,
-		maxResponseSize: defaultMaxResponseSize,
+		gun:        "kolide/agent/darwin",
+		url:        baseURL,
+		sizeLimits: defaultSizeLimits,
 		client: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: &tls.Config{
@@ -145,9 +145,9 @@ func TestGetVersionRoot(t *testing.T) {
 
 	baseURL, _ := url.Parse(svr.URL)
 	r := notaryRepo{
-		gun:             "kolide/agent/darwin",
-		url:             baseURL,
-		maxResponseSize: defaultMaxResponseSize,
+		gun:        "kolide/agent/darwin",
+		url:        baseURL,
+		sizeLimits: defaultSizeLimits,
 		client: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: &tls.Config{
@@ -174,9 +174,9 @@ func TestGetRoot(t *testing.T) {
 
 	baseURL, _ := url.Parse(svr.URL)
 	r := notaryRepo{
-		gun:             "kolide/agent/darwin",
-		url:             baseURL,
-		maxResponseSize: defaultMaxResponseSize,
+		gun:        "kolide/agent/darwin",
+		url:        baseURL,
+		sizeLimits: defaultSizeLimits,
 		client: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: &tls.Config{
@@ -202,9 +202,9 @@ func TestGetTimestamp(t *testing.T) {
 
 	baseURL, _ := url.Parse(svr.URL)
 	r := notaryRepo{
-		gun:             "kolide/agent/darwin",
-		url:             baseURL,
-		maxResponseSize: defaultMaxResponseSize,
+		gun:        "kolide/agent/darwin",
+		url:        baseURL,
+		sizeLimits: defaultSizeLimits,
 		client: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: &tls.Config{
@@ -230,9 +230,9 @@ func TestGetSnapshot(t *testing.T) {
 
 	baseURL, _ := url.Parse(svr.URL)
 	r := notaryRepo{
-		gun:             "kolide/agent/darwin",
-		url:             baseURL,
-		maxResponseSize: defaultMaxResponseSize,
+		gun:        "kolide/agent/darwin",
+		url:        baseURL,
+		sizeLimits: defaultSizeLimits,
 		client: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: &tls.Config{
@@ -257,9 +257,9 @@ func Test404ErrorPassesThrough(t *testing.T) {
 
 	baseURL, _ := url.Parse(svr.URL)
 	r := notaryRepo{
-		gun:             "kolide/agent/darwin",
-		url:             baseURL,
-		maxResponseSize: defaultMaxResponseSize,
+		gun:        "kolide/agent/darwin",
+		url:        baseURL,
+		sizeLimits: defaultSizeLimits,
 		client: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: &tls.Config{
@@ -282,9 +282,9 @@ func TestPingSuccess(t *testing.T) {
 
 	baseURL, _ := url.Parse(svr.URL)
 	r := notaryRepo{
-		gun:             "kolide/agent/darwin",
-		url:             baseURL,
-		maxResponseSize: defaultMaxResponseSize,
+		gun:        "kolide/agent/darwin",
+		url:        baseURL,
+		sizeLimits: defaultSizeLimits,
 		client: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: &tls.Config{
@@ -306,9 +306,9 @@ func TestPingFail(t *testing.T) {
 
 	baseURL, _ := url.Parse(svr.URL)
 	r := notaryRepo{
-		gun:             "kolide/agent/darwin",
-		url:             baseURL,
-		maxResponseSize: defaultMaxResponseSize,
+		gun:        "kolide/agent/darwin",
+		url:        baseURL,
+		sizeLimits: defaultSizeLimits,
 		client: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: &tls.Config{
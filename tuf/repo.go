@@ -1,6 +1,7 @@
 package tuf
 
 import (
+	"io"
 	"net/http"
 	"net/url"
 	"os"
@@ -69,6 +70,9 @@ type repo interface {
 type remoteRepo interface {
 	repo
 	ping() error
+	// openRole returns the unverified contents of a role, including
+	// delegated targets roles. Returns errNotFound if the role does not exist.
+	openRole(name string) (io.ReadCloser, error)
 }
 
 type persistentRepo interface {
@@ -83,10 +87,11 @@ type localRepo struct {
 func (r localRepo) baseDir() string { return r.repoPath }
 
 type notaryRepo struct {
-	url             *url.URL
-	gun             string
-	maxResponseSize int64
-	client          *http.Client
+	url        *url.URL
+	gun        string
+	sizeLimits SizeLimits
+	client     *http.Client
+	limits     retrievalLimits
 }
 
 func newLocalRepo(repoPath string) (*localRepo, error) {
@@ -102,17 +107,16 @@ func newLocalRepo(repoPath string) (*localRepo, error) {
 	return &repo, nil
 }
 
-func newNotaryRepo(settings *Settings, maxResponseSize int64, client *http.Client) (*notaryRepo, error) {
+func newNotaryRepo(settings *Settings, sizeLimits SizeLimits, client *http.Client) (*notaryRepo, error) {
 	r := &notaryRepo{
-		maxResponseSize: maxResponseSize,
-		gun:             settings.GUN,
-		client:          client,
+		sizeLimits: sizeLimits,
+		gun:        settings.GUN,
+		client:     client,
 	}
 	var err error
-	// TODO remove, already validated in settings.verify
 	r.url, err = validateURL(settings.NotaryURL)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "remote repo url validation")
 	}
 	return r, nil
 }
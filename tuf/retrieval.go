@@ -0,0 +1,249 @@
+package tuf
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/pkg/errors"
+)
+
+// ErrSlowRetrieval is returned when a download of metadata or a target is
+// aborted because it took longer than its deadline, or because it arrived
+// more slowly than the minimum throughput. This protects against the slow
+// retrieval attack described in the TUF specification, where a mirror or
+// Notary server trickles data to keep a client from ever seeing an update.
+var ErrSlowRetrieval = errors.New("slow retrieval")
+
+const (
+	defaultMetadataDeadline = 30 * time.Second
+	defaultMinThroughput    = int64(1024)
+	defaultThroughputWindow = 10 * time.Second
+)
+
+// WithMetadataDeadline limits how long the download of each metadata role
+// may take. The default is 30 seconds, zero removes the limit.
+func WithMetadataDeadline(deadline time.Duration) Option {
+	return func(c *Client) {
+		c.metadataDeadline = deadline
+	}
+}
+
+// WithTargetDeadline limits how long the download of each target may take.
+// By default targets have no deadline and are only subject to the minimum
+// throughput, because they can be arbitrarily large.
+func WithTargetDeadline(deadline time.Duration) Option {
+	return func(c *Client) {
+		c.targetDeadline = deadline
+	}
+}
+
+// WithMinThroughput aborts downloads of metadata and targets that receive
+// fewer than bytesPerSecond bytes per second, averaged over each window. Only
+// time spent waiting for the server counts, not time spent writing what has
+// been received. The default is 1KiB per second over 10 seconds. A zero rate
+// disables the check. With WithBandwidthLimit the minimum is lowered to half
+// of the bandwidth limit if it isn't already below it.
+func WithMinThroughput(bytesPerSecond int64, window time.Duration) Option {
+	return func(c *Client) {
+		c.minThroughput = bytesPerSecond
+		c.throughputWindow = window
+	}
+}
+
+// retrievalLimits bounds how long a single download may take.
+type retrievalLimits struct {
+	deadline      time.Duration
+	minThroughput int64
+	window        time.Duration
+	clock         clock.Clock
+}
+
+func (c *Client) retrievalLimits(deadline time.Duration) retrievalLimits {
+	return retrievalLimits{
+		deadline:      deadline,
+		minThroughput: c.minThroughput,
+		window:        c.throughputWindow,
+		clock:         c.clock,
+	}
+}
+
+func (l retrievalLimits) enabled() bool {
+	return l.deadline > 0 || (l.minThroughput > 0 && l.window > 0)
+}
+
+// watchdog aborts a download that exceeds its limits. It is started before
+// the request is made, so that the deadline includes waiting for a response.
+type watchdog struct {
+	limits retrievalLimits
+	read   int64
+	// waited is the time spent in finished reads, in nanoseconds, and
+	// waitingSince is when the current read, or the wait for a response,
+	// started. The minimum throughput is measured over this time only, so
+	// that a slow destination isn't mistaken for a slow server.
+	waited       int64
+	waitingSince int64
+	tripped      int32
+	done         chan struct{}
+	stopped      sync.Once
+
+	mu    sync.Mutex
+	abort func()
+}
+
+// startWatchdog starts watching a download. abort, which may be nil, is
+// called if the download is too slow. A nil watchdog is returned if limits
+// are disabled, and all watchdog methods can be called on it.
+func startWatchdog(limits retrievalLimits, abort func()) *watchdog {
+	if !limits.enabled() {
+		return nil
+	}
+	w := &watchdog{
+		limits:       limits,
+		waitingSince: limits.clock.Now().UnixNano(),
+		done:         make(chan struct{}),
+		abort:        abort,
+	}
+	go w.run()
+	return w
+}
+
+func (w *watchdog) run() {
+	var deadline <-chan time.Time
+	if w.limits.deadline > 0 {
+		deadline = w.limits.clock.After(w.limits.deadline)
+	}
+	checkRate := w.limits.minThroughput > 0 && w.limits.window > 0
+	var (
+		previousRead   int64
+		previousWaited time.Duration
+	)
+	for {
+		var check <-chan time.Time
+		if checkRate {
+			check = w.limits.clock.After(w.limits.window)
+		}
+		select {
+		case <-w.done:
+			return
+		case <-deadline:
+			w.trip()
+			return
+		case <-check:
+			waited := w.waitedFor()
+			if waited-previousWaited < w.limits.window {
+				continue
+			}
+			read := atomic.LoadInt64(&w.read)
+			minimum := float64(w.limits.minThroughput) * (waited - previousWaited).Seconds()
+			if float64(read-previousRead) < minimum {
+				w.trip()
+				return
+			}
+			previousRead, previousWaited = read, waited
+		}
+	}
+}
+
+// waitedFor returns the total time spent waiting for the server.
+func (w *watchdog) waitedFor() time.Duration {
+	waited := atomic.LoadInt64(&w.waited)
+	if since := atomic.LoadInt64(&w.waitingSince); since != 0 {
+		waited += w.limits.clock.Now().UnixNano() - since
+	}
+	return time.Duration(waited)
+}
+
+func (w *watchdog) startWaiting() {
+	atomic.CompareAndSwapInt64(&w.waitingSince, 0, w.limits.clock.Now().UnixNano())
+}
+
+func (w *watchdog) stopWaiting() {
+	if since := atomic.SwapInt64(&w.waitingSince, 0); since != 0 {
+		atomic.AddInt64(&w.waited, w.limits.clock.Now().UnixNano()-since)
+	}
+}
+
+func (w *watchdog) trip() {
+	atomic.StoreInt32(&w.tripped, 1)
+	w.mu.Lock()
+	abort := w.abort
+	w.mu.Unlock()
+	if abort != nil {
+		abort()
+	}
+}
+
+// err returns ErrSlowRetrieval if the watchdog aborted the download, and err
+// otherwise.
+func (w *watchdog) err(err error) error {
+	if w != nil && atomic.LoadInt32(&w.tripped) == 1 {
+		return ErrSlowRetrieval
+	}
+	return err
+}
+
+func (w *watchdog) stop() {
+	if w == nil {
+		return
+	}
+	w.stopped.Do(func() { close(w.done) })
+}
+
+// watch returns body with reads counted toward the minimum throughput. The
+// body is closed if the watchdog trips, and reads then fail with
+// ErrSlowRetrieval. Closing the returned body stops the watchdog.
+func (w *watchdog) watch(body io.ReadCloser) io.ReadCloser {
+	if w == nil {
+		return body
+	}
+	w.mu.Lock()
+	previous := w.abort
+	w.abort = func() {
+		if previous != nil {
+			previous()
+		}
+		body.Close()
+	}
+	w.mu.Unlock()
+	if atomic.LoadInt32(&w.tripped) == 1 {
+		body.Close()
+	}
+	return &watchedBody{body: body, w: w}
+}
+
+type watchedBody struct {
+	body io.ReadCloser
+	w    *watchdog
+}
+
+func (b *watchedBody) Read(p []byte) (int, error) {
+	b.w.startWaiting()
+	n, err := b.body.Read(p)
+	b.w.stopWaiting()
+	atomic.AddInt64(&b.w.read, int64(n))
+	if err != nil {
+		err = b.w.err(err)
+	}
+	return n, err
+}
+
+func (b *watchedBody) Close() error {
+	b.w.stop()
+	return b.body.Close()
+}
+
+// cancelingBody cancels the request's context when the body is closed.
+type cancelingBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
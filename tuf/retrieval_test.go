@@ -0,0 +1,113 @@
+package tuf
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stalledBody blocks reads until it is closed.
+type stalledBody struct {
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (b *stalledBody) Read(p []byte) (int, error) {
+	<-b.closed
+	return 0, io.ErrUnexpectedEOF
+}
+
+func (b *stalledBody) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return nil
+}
+
+// advance runs k a second at a time until done is closed.
+func advance(k *clock.MockClock, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Millisecond):
+			k.AddTime(time.Second)
+		}
+	}
+}
+
+func TestWatchdogAbortsStalledDownload(t *testing.T) {
+	for name, limits := range map[string]retrievalLimits{
+		"deadline":   {deadline: 30 * time.Second},
+		"throughput": {minThroughput: 1024, window: 10 * time.Second},
+	} {
+		t.Run(name, func(t *testing.T) {
+			k := clock.NewMockClock(time.Now())
+			limits.clock = k
+			aborted := make(chan struct{})
+			w := startWatchdog(limits, func() { close(aborted) })
+			body := w.watch(&stalledBody{closed: make(chan struct{})})
+			done := make(chan struct{})
+			defer close(done)
+			go advance(k, done)
+
+			_, err := ioutil.ReadAll(body)
+			assert.Equal(t, ErrSlowRetrieval, err)
+			<-aborted
+			require.NoError(t, body.Close())
+		})
+	}
+}
+
+func TestWatchdogPassesCompleteDownload(t *testing.T) {
+	limits := retrievalLimits{deadline: time.Second, minThroughput: 1024, window: time.Second, clock: clock.NewMockClock(time.Now())}
+	w := startWatchdog(limits, nil)
+	body := w.watch(ioutil.NopCloser(strings.NewReader("content")))
+	buff, err := ioutil.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(buff))
+	require.NoError(t, body.Close())
+	assert.Equal(t, io.EOF, w.err(io.EOF))
+
+	// disabled limits don't wrap the body
+	w = startWatchdog(retrievalLimits{}, nil)
+	assert.Nil(t, w)
+	rdr := ioutil.NopCloser(strings.NewReader("content"))
+	assert.Equal(t, rdr, w.watch(rdr))
+	w.stop()
+}
+
+func TestWatchdogIgnoresSlowDestination(t *testing.T) {
+	k := clock.NewMockClock(time.Now())
+	limits := retrievalLimits{minThroughput: 1024, window: 10 * time.Second, clock: k}
+	w := startWatchdog(limits, nil)
+	body := w.watch(ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 100))))
+	defer body.Close()
+
+	// the server responds immediately, but each write takes longer than a window
+	buff := make([]byte, 10)
+	for i := 0; i < 5; i++ {
+		_, err := body.Read(buff)
+		require.NoError(t, err)
+		k.AddTime(20 * time.Second)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, w.err(nil))
+}
+
+func TestMinThroughputBelowBandwidthLimit(t *testing.T) {
+	f, cleanup := setupAttack(t)
+	defer cleanup()
+	client := f.newClient(t, WithBandwidthLimit(512))
+	defer client.Stop()
+	assert.Equal(t, int64(256), client.minThroughput)
+
+	client = f.newClient(t, WithBandwidthLimit(1<<20))
+	defer client.Stop()
+	assert.Equal(t, defaultMinThroughput, client.minThroughput)
+}
@@ -62,12 +62,33 @@ type signedkeyed interface {
 	signed
 }
 
+// rawRole is a role exactly as it was read. Roles are saved unchanged, rather
+// than encoded again, so that they still match the hashes and lengths listed
+// by their parent roles.
+type rawRole struct {
+	raw []byte
+}
+
+func (r *rawRole) setRaw(buff []byte) {
+	r.raw = append([]byte(nil), buff...)
+}
+
+func (r *rawRole) rawBytes() []byte {
+	return r.raw
+}
+
+type rawer interface {
+	setRaw(buff []byte)
+	rawBytes() []byte
+}
+
 // Root is the root role. It indicates
 // which keys are authorized for all top-level roles, including the root
 // role itself.
 type Root struct {
 	Signed     SignedRoot  `json:"signed"`
 	Signatures []Signature `json:"signatures"`
+	rawRole
 }
 
 // Keys get key map for root role
@@ -100,6 +121,7 @@ func (sr SignedRoot) canonicalJSON() ([]byte, error) {
 type Snapshot struct {
 	Signed     SignedSnapshot `json:"signed"`
 	Signatures []Signature    `json:"signatures"`
+	rawRole
 }
 
 // SignedSnapshot is the signed portion of the snapshot
@@ -119,6 +141,7 @@ func (sr SignedSnapshot) canonicalJSON() ([]byte, error) {
 type Timestamp struct {
 	Signed     SignedTimestamp `json:"signed"`
 	Signatures []Signature     `json:"signatures"`
+	rawRole
 }
 
 // SignedTimestamp signed portion of timestamp role.
@@ -139,6 +162,7 @@ type Targets struct {
 	Signed       SignedTarget `json:"signed"`
 	Signatures   []Signature  `json:"signatures"`
 	delegateRole string
+	rawRole
 }
 
 // FimMap is used to map paths to hashes and length information about that
@@ -0,0 +1,249 @@
+package tuf
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/pkg/errors"
+)
+
+const (
+	s3Service        = "s3"
+	s3SigningAlgo    = "AWS4-HMAC-SHA256"
+	s3DateFormat     = "20060102T150405Z"
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3Credentials are used to sign requests to an S3 compatible object store.
+type S3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is only needed for temporary credentials.
+	SessionToken string
+}
+
+// S3MirrorConfig describes a bucket in an S3 compatible object store, such as
+// AWS S3 or MinIO, containing targets at <Prefix>/<GUN>/<target>.
+type S3MirrorConfig struct {
+	// Endpoint is the https URL of the object store, i.e.
+	// https://s3.us-east-1.amazonaws.com
+	Endpoint string
+	Bucket   string
+	Region   string
+	// Prefix is prepended to object keys, it may be empty.
+	Prefix string
+	// PathStyle addresses the bucket as part of the path,
+	// https://endpoint/bucket/key, instead of as part of the host name,
+	// https://bucket.endpoint/key. Most S3 compatible servers need this.
+	PathStyle bool
+	// Credentials is called before each download to get the credentials used
+	// to sign the request, so that expiring credentials can be refreshed. If
+	// nil, requests are anonymous.
+	Credentials func() (S3Credentials, error)
+	// SignURL, if not nil, returns a presigned https URL for an object which is
+	// used instead of signing the request with Credentials.
+	SignURL func(bucket, key string) (string, error)
+}
+
+// WithS3Mirror downloads targets from an S3 compatible object store instead
+// of from MirrorURL. Requests are made with the Client's http.Client.
+func WithS3Mirror(config S3MirrorConfig) Option {
+	return func(c *Client) {
+		c.newMirrorTransport = func(c *Client) (MirrorTransport, error) {
+			return newS3Mirror(config, c.client, c.clock)
+		}
+	}
+}
+
+type s3Mirror struct {
+	config   S3MirrorConfig
+	endpoint *url.URL
+	client   *http.Client
+	clock    clock.Clock
+}
+
+func newS3Mirror(config S3MirrorConfig, client *http.Client, k clock.Clock) (*s3Mirror, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("s3 bucket can't be empty")
+	}
+	if config.Region == "" && config.SignURL == nil {
+		return nil, errors.New("s3 region can't be empty")
+	}
+	var endpoint *url.URL
+	if config.SignURL == nil {
+		var err error
+		endpoint, err = validateURL(config.Endpoint)
+		if err != nil {
+			return nil, errors.Wrap(err, "s3 endpoint validation")
+		}
+	}
+	return &s3Mirror{config: config, endpoint: endpoint, client: client, clock: k}, nil
+}
+
+// Open downloads a target from the bucket.
+func (m *s3Mirror) Open(gun, target string) (io.ReadCloser, error) {
+	return m.OpenContext(context.Background(), gun, target)
+}
+
+// OpenContext downloads a target from the bucket, aborting if ctx is
+// canceled.
+func (m *s3Mirror) OpenContext(ctx context.Context, gun, target string) (io.ReadCloser, error) {
+	key := strings.TrimPrefix(path.Join(m.config.Prefix, gun, target), "/")
+	if m.config.SignURL != nil {
+		return openSignedURL(ctx, m.client, m.config.SignURL, m.config.Bucket, key)
+	}
+	u := *m.endpoint
+	if m.config.PathStyle {
+		u.Path = path.Join("/", u.Path, m.config.Bucket, key)
+	} else {
+		u.Host = m.config.Bucket + "." + u.Host
+		u.Path = path.Join("/", u.Path, key)
+	}
+	request, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating target request")
+	}
+	request.Header.Add(cacheControl, cachePolicyNoStore)
+	if m.config.Credentials != nil {
+		creds, err := m.config.Credentials()
+		if err != nil {
+			return nil, errors.Wrap(err, "getting s3 credentials")
+		}
+		signV4(request, creds, m.config.Region, s3Service, m.clock.Now(), emptyPayloadHash)
+	}
+	return getTarget(ctx, m.client, request)
+}
+
+// openSignedURL downloads an object using a presigned URL, which already
+// contains everything needed to authorize the request.
+func openSignedURL(ctx context.Context, client *http.Client, signURL func(bucket, key string) (string, error), bucket, key string) (io.ReadCloser, error) {
+	signed, err := signURL(bucket, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "signing target url")
+	}
+	u, err := validateURL(signed)
+	if err != nil {
+		return nil, errors.Wrap(err, "signed url validation")
+	}
+	request, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating target request")
+	}
+	request.Header.Add(cacheControl, cachePolicyNoStore)
+	return getTarget(ctx, client, request)
+}
+
+// signV4 adds an AWS Signature Version 4 Authorization header to request,
+// signing the host and every header already set on the request.
+// See https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func signV4(request *http.Request, creds S3Credentials, region, service string, now time.Time, payloadHash string) {
+	amzDate := now.UTC().Format(s3DateFormat)
+	date := amzDate[:8]
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": request.Host}
+	if request.Host == "" {
+		headers["host"] = request.URL.Host
+	}
+	for name, values := range request.Header {
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalURI := uriEncode(request.URL.Path, false)
+	if canonicalURI == "" {
+		canonicalURI = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		canonicalURI,
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3SigningAlgo,
+		amzDate,
+		scope,
+		hex.EncodeToString(hashed[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SigningAlgo, creds.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for k, values := range query {
+		for _, v := range values {
+			params = append(params, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// uriEncode percent encodes every byte except unreserved characters, and
+// slashes unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
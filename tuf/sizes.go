@@ -0,0 +1,59 @@
+package tuf
+
+import (
+	"strings"
+)
+
+// SizeLimits are the most bytes read for each metadata role. The timestamp
+// lists the length of the snapshot, and the snapshot lists the length of
+// each targets role, so the Snapshot and Targets limits are only used when
+// those lengths are missing. Root and Timestamp limits always apply.
+type SizeLimits struct {
+	Root      int64
+	Timestamp int64
+	Snapshot  int64
+	// Targets applies to the targets role and to delegated targets roles.
+	Targets int64
+}
+
+// defaultSizeLimits follow the defaults of the TUF reference implementation.
+var defaultSizeLimits = SizeLimits{
+	Root:      512 * 1024,
+	Timestamp: 16 * 1024,
+	Snapshot:  2 * 1024 * 1024,
+	Targets:   defaultMaxResponseSize,
+}
+
+// WithSizeLimits changes the most bytes read for each metadata role. Fields
+// that are zero keep their default.
+func WithSizeLimits(limits SizeLimits) Option {
+	return func(c *Client) {
+		if limits.Root > 0 {
+			c.sizeLimits.Root = limits.Root
+		}
+		if limits.Timestamp > 0 {
+			c.sizeLimits.Timestamp = limits.Timestamp
+		}
+		if limits.Snapshot > 0 {
+			c.sizeLimits.Snapshot = limits.Snapshot
+		}
+		if limits.Targets > 0 {
+			c.sizeLimits.Targets = limits.Targets
+		}
+	}
+}
+
+// forRole returns the limit for a role, including versioned roots such as
+// 2.root and delegated targets roles.
+func (l SizeLimits) forRole(roleName string) int64 {
+	switch {
+	case roleName == string(roleRoot) || strings.HasSuffix(roleName, "."+string(roleRoot)):
+		return l.Root
+	case roleName == string(roleTimestamp):
+		return l.Timestamp
+	case roleName == string(roleSnapshot):
+		return l.Snapshot
+	default:
+		return l.Targets
+	}
+}
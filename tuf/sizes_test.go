@@ -0,0 +1,55 @@
+package tuf
+
+import (
+	"testing"
+
+	"github.com/kolide/updater/tuf/authoring"
+	"github.com/kolide/updater/tuf/tuftest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeLimitsForRole(t *testing.T) {
+	limits := SizeLimits{Root: 1, Timestamp: 2, Snapshot: 3, Targets: 4}
+	assert.Equal(t, int64(1), limits.forRole("root"))
+	assert.Equal(t, int64(1), limits.forRole("3.root"))
+	assert.Equal(t, int64(2), limits.forRole("timestamp"))
+	assert.Equal(t, int64(3), limits.forRole("snapshot"))
+	assert.Equal(t, int64(4), limits.forRole("targets"))
+	assert.Equal(t, int64(4), limits.forRole("targets/releases"))
+
+	c := newClient(WithSizeLimits(SizeLimits{Timestamp: 100}))
+	expected := defaultSizeLimits
+	expected.Timestamp = 100
+	assert.Equal(t, expected, c.sizeLimits)
+}
+
+func TestSizeLimitsEnforced(t *testing.T) {
+	f, cleanup := setupAttack(t)
+	defer cleanup()
+	update := func(limits SizeLimits) error {
+		client := f.newClient(t, WithSizeLimits(limits))
+		defer client.Stop()
+		_, _, err := client.Update()
+		return err
+	}
+
+	assert.Error(t, update(SizeLimits{Timestamp: 64}))
+	require.NoError(t, update(SizeLimits{}))
+
+	// a snapshot that omits the length of targets falls back to the limit
+	targets, _ := f.server.Role(authoring.RoleTargets)
+	published, _ := f.server.Role(authoring.RoleSnapshot)
+	var snapshot authoring.Snapshot
+	forged := forge(t, published, &snapshot, func() {
+		snapshot.Signed.Version++
+		meta := snapshot.Signed.Meta[authoring.RoleTargets]
+		meta.Length = 0
+		snapshot.Signed.Meta[authoring.RoleTargets] = meta
+	}, f.server.Keys.Snapshot)
+	f.server.SetRoleFault(authoring.RoleSnapshot, tuftest.ReplaceFault(forged))
+	forgeTimestamp(t, f, forged)
+
+	assert.Error(t, update(SizeLimits{Targets: int64(len(targets) - 1)}))
+	assert.NoError(t, update(SizeLimits{Targets: int64(len(targets))}))
+}
@@ -0,0 +1,106 @@
+package tuf
+
+import (
+	"io"
+	"time"
+
+	"github.com/WatchBeam/clock"
+)
+
+// WithBandwidthLimit limits target downloads to bytesPerSecond. Metadata
+// downloads from Notary are small and are not limited.
+func WithBandwidthLimit(bytesPerSecond int64) Option {
+	return func(c *Client) {
+		c.bandwidthLimit = bytesPerSecond
+	}
+}
+
+// rateLimitedReader limits the rate at which bytes can be read using a token
+// bucket which holds up to one second worth of bytes.
+type rateLimitedReader struct {
+	rdr    io.Reader
+	rate   int64
+	tokens int64
+	last   time.Time
+	clock  clock.Clock
+}
+
+func newRateLimitedReader(rdr io.Reader, bytesPerSecond int64, k clock.Clock) *rateLimitedReader {
+	return &rateLimitedReader{
+		rdr:    rdr,
+		rate:   bytesPerSecond,
+		tokens: bytesPerSecond,
+		last:   k.Now(),
+		clock:  k,
+	}
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.rate {
+		p = p[:r.rate]
+	}
+	r.refill()
+	if r.tokens <= 0 {
+		// Wait for a tenth of a second worth of tokens rather than enough
+		// for all of p, which may be more than the reader has left.
+		want := r.rate / 10
+		if want < 1 {
+			want = 1
+		}
+		if want > int64(len(p)) {
+			want = int64(len(p))
+		}
+		wait := float64(want-r.tokens) / float64(r.rate)
+		r.clock.Sleep(time.Duration(wait * float64(time.Second)))
+		r.refill()
+	}
+	if r.tokens > 0 && int64(len(p)) > r.tokens {
+		p = p[:r.tokens]
+	}
+	n, err := r.rdr.Read(p)
+	r.tokens -= int64(n)
+	return n, err
+}
+
+func (r *rateLimitedReader) refill() {
+	now := r.clock.Now()
+	elapsed := now.Sub(r.last)
+	r.last = now
+	// Capped at the size of the bucket before converting, so that long waits
+	// or high rates can't overflow.
+	added := elapsed.Seconds() * float64(r.rate)
+	if added >= float64(r.rate-r.tokens) {
+		r.tokens = r.rate
+		return
+	}
+	r.tokens += int64(added)
+}
+
+// DownloadWindow is the time of day during which the autoupdater is allowed
+// to download new targets. Start and End are offsets from midnight in the
+// local time zone. If End is before Start the window spans midnight, i.e.
+// Start 22h, End 6h allows downloads overnight.
+type DownloadWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// WithDownloadWindow only allows the autoupdater to download new targets
+// between start and end each day, see DownloadWindow. Metadata is still
+// updated outside of the window, and explicit calls to Download are not
+// affected.
+func WithDownloadWindow(start, end time.Duration) Option {
+	return func(c *Client) {
+		c.downloadWindow = &DownloadWindow{Start: start, End: end}
+	}
+}
+
+// Contains returns true if t is within the window.
+func (w DownloadWindow) Contains(t time.Time) bool {
+	year, month, day := t.Date()
+	offset := t.Sub(time.Date(year, month, day, 0, 0, 0, 0, t.Location()))
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
@@ -0,0 +1,143 @@
+package tuf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitedReader(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 3000)
+	start := time.Now()
+	buff, err := ioutil.ReadAll(newRateLimitedReader(bytes.NewReader(content), 2000, &clock.DefaultClock{}))
+	require.NoError(t, err)
+	assert.Equal(t, content, buff)
+	// the first second worth of bytes is available immediately
+	assert.True(t, time.Since(start) >= 400*time.Millisecond, time.Since(start))
+}
+
+func TestRateLimitedReaderRefill(t *testing.T) {
+	k := clock.NewMockClock(time.Now())
+	r := newRateLimitedReader(bytes.NewReader(nil), math.MaxInt64/2, k)
+	r.tokens = 0
+	k.AddTime(24 * time.Hour)
+	r.refill()
+	assert.Equal(t, r.rate, r.tokens)
+
+	r = newRateLimitedReader(bytes.NewReader(nil), 1000, k)
+	r.tokens = -100
+	k.AddTime(500 * time.Millisecond)
+	r.refill()
+	assert.Equal(t, int64(400), r.tokens)
+}
+
+func TestDownloadWindowContains(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2017, 7, 1, hour, min, 0, 0, time.UTC)
+	}
+	daytime := DownloadWindow{Start: 9 * time.Hour, End: 17 * time.Hour}
+	assert.True(t, daytime.Contains(at(9, 0)))
+	assert.True(t, daytime.Contains(at(16, 59)))
+	assert.False(t, daytime.Contains(at(17, 0)))
+	assert.False(t, daytime.Contains(at(3, 0)))
+
+	overnight := DownloadWindow{Start: 22 * time.Hour, End: 6 * time.Hour}
+	assert.True(t, overnight.Contains(at(23, 30)))
+	assert.True(t, overnight.Contains(at(2, 0)))
+	assert.False(t, overnight.Contains(at(6, 0)))
+	assert.False(t, overnight.Contains(at(12, 0)))
+}
+
+func TestDownloadWindowAutoupdate(t *testing.T) {
+	settings, stageDir, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+
+	var called bool
+	onUpdate := func(stagingPath string, err error) {
+		called = true
+	}
+	client, err := NewClient(
+		settings, WithHTTPClient(testHTTPClient()),
+		withClock(clock.NewMockClock(testTime)),
+		WithAutoUpdate("edge/target", stageDir, onUpdate),
+		WithDownloadWindow(time.Hour, 5*time.Hour),
+	)
+	require.NoError(t, err)
+	client.Stop()
+	assert.False(t, called)
+
+	client, err = NewClient(
+		settings, WithHTTPClient(testHTTPClient()),
+		withClock(clock.NewMockClock(testTime.Add(9*time.Hour))),
+		WithAutoUpdate("edge/target", stageDir, onUpdate),
+		WithDownloadWindow(time.Hour, 5*time.Hour),
+	)
+	require.NoError(t, err)
+	client.Stop()
+	assert.True(t, called)
+}
+
+// connectProxy is an https proxy which requires basic authentication.
+func connectProxy(t *testing.T, user, password string) (*httptest.Server, *int32) {
+	var tunnels int32
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Proxy-Authorization") != expected {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		require.NoError(t, err)
+		atomic.AddInt32(&tunnels, 1)
+		w.WriteHeader(http.StatusOK)
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		go func() {
+			io.Copy(upstream, rw)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+	return proxy, &tunnels
+}
+
+func TestProxy(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	k := clock.NewMockClock(testTime)
+	settings, _, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	proxy, tunnels := connectProxy(t, "agent", "secret")
+	defer proxy.Close()
+
+	_, err := NewClient(settings, WithHTTPClient(testHTTPClient()), withClock(k), WithProxy("http://agent:wrong@"+proxy.Listener.Addr().String()))
+	require.Error(t, err)
+
+	client, err := NewClient(settings, WithHTTPClient(testHTTPClient()), withClock(k), WithProxy("http://agent:secret@"+proxy.Listener.Addr().String()))
+	require.NoError(t, err)
+	defer client.Stop()
+	_, _, err = client.Update()
+	require.NoError(t, err)
+	require.NoError(t, client.Download("edge/target", ioutil.Discard))
+	assert.True(t, atomic.LoadInt32(tunnels) >= 2)
+
+	_, err = NewClient(settings, withClock(k), WithProxy("socks6://proxy"))
+	require.Error(t, err)
+}
@@ -0,0 +1,117 @@
+package tuf
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/pkg/errors"
+)
+
+// TimeSource provides the current time from somewhere that is trusted more
+// than the host's clock, such as a signed time service.
+type TimeSource interface {
+	Now() (time.Time, error)
+}
+
+// TimeSourceFunc adapts a function to a TimeSource.
+type TimeSourceFunc func() (time.Time, error)
+
+// Now returns the result of calling f.
+func (f TimeSourceFunc) Now() (time.Time, error) {
+	return f()
+}
+
+// WithTimeSource checks role expiration against the time from source instead
+// of the host's clock, so that hosts with a bad clock neither reject current
+// metadata as frozen nor accept stale metadata. The source is queried before
+// each update, and the update fails if it can't be reached.
+func WithTimeSource(source TimeSource) Option {
+	return func(c *Client) {
+		c.timeSource = source
+	}
+}
+
+// WithNotaryTime uses the Date header returned by the Notary server as the
+// trusted time. It can't be used with file URLs or bundles.
+func WithNotaryTime() Option {
+	return func(c *Client) {
+		c.notaryTime = true
+	}
+}
+
+// trustedClock is the host clock, offset to agree with a TimeSource when it
+// was last synced.
+type trustedClock struct {
+	clock.Clock
+	source TimeSource
+
+	mu     sync.Mutex
+	offset time.Duration
+}
+
+// newTrustedClock returns nil if no time source is configured.
+func (c *Client) newTrustedClock(notary remoteRepo) (*trustedClock, error) {
+	source := c.timeSource
+	if c.notaryTime {
+		nr, ok := notary.(*notaryRepo)
+		if !ok {
+			return nil, errors.New("notary time requires a notary server")
+		}
+		source = TimeSourceFunc(nr.serverTime)
+	}
+	if source == nil {
+		return nil, nil
+	}
+	return &trustedClock{Clock: c.clock, source: source}, nil
+}
+
+// useTrustedClock checks expiration and tags backups with tk, which is synced
+// at the start of each refresh. A nil tk leaves the clock unchanged.
+func (rs *repoMan) useTrustedClock(tk *trustedClock) {
+	if tk == nil {
+		return
+	}
+	rs.clock = tk
+	rs.trustedClock = tk
+}
+
+func (k *trustedClock) Now() time.Time {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.Clock.Now().Add(k.offset)
+}
+
+func (k *trustedClock) sync() error {
+	trusted, err := k.source.Now()
+	if err != nil {
+		return errors.Wrap(err, "getting trusted time")
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.offset = trusted.Sub(k.Clock.Now())
+	return nil
+}
+
+// serverTime returns the time in the Date header of a response from the
+// Notary server.
+func (r *notaryRepo) serverTime() (time.Time, error) {
+	resp, err := r.health()
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "server time")
+	}
+	// An error page may come from a proxy rather than Notary itself.
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return time.Time{}, errors.Errorf("notary server error %q", resp.Status)
+	}
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return time.Time{}, errors.New("notary response has no date")
+	}
+	t, err := http.ParseTime(date)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "parsing notary date")
+	}
+	return t, nil
+}
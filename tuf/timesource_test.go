@@ -0,0 +1,91 @@
+package tuf
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/kolide/updater/tuf/authoring"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedTimeSource(t *testing.T) {
+	f, cleanup := setupAttack(t)
+	defer cleanup()
+	update := func(opts ...Option) error {
+		client := f.newClient(t, opts...)
+		defer client.Stop()
+		_, _, err := client.Update()
+		return err
+	}
+	now := TimeSourceFunc(func() (time.Time, error) { return time.Now(), nil })
+
+	// a host clock that is far ahead falsely detects a freeze attack
+	ahead := time.Now().Add(2 * 365 * 24 * time.Hour)
+	f.clock.SetTime(ahead)
+	assert.Equal(t, errFreezeAttack, errors.Cause(update()))
+	require.NoError(t, update(WithTimeSource(now)))
+	require.NoError(t, update(WithNotaryTime()))
+
+	// backups are tagged using the trusted time
+	backups := func(year time.Time) []string {
+		matches, err := filepath.Glob(filepath.Join(f.local, "root."+year.UTC().Format("2006")+"*.json"))
+		require.NoError(t, err)
+		return matches
+	}
+	assert.NotEmpty(t, backups(time.Now()))
+	assert.Empty(t, backups(ahead))
+
+	// a host clock that is behind accepts stale metadata
+	require.NoError(t, f.server.SetExpires(authoring.RoleTimestamp, time.Now().Add(-time.Hour)))
+	behind := withClock(clock.NewMockClock(time.Now().Add(-24 * time.Hour)))
+	require.NoError(t, update(behind))
+	assert.Equal(t, errFreezeAttack, errors.Cause(update(behind, WithTimeSource(now))))
+
+	// updates fail if the time source can't be reached
+	unavailable := TimeSourceFunc(func() (time.Time, error) { return time.Time{}, errors.New("unavailable") })
+	assert.Error(t, update(WithTimeSource(unavailable)))
+}
+
+func TestNotaryTimeRequiresSuccess(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	svr := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer svr.Close()
+	notary, err := newNotaryRepo(&Settings{NotaryURL: svr.URL, GUN: testGUN}, defaultSizeLimits, svr.Client())
+	require.NoError(t, err)
+
+	// the date of an error page may come from a proxy with the wrong time
+	_, err = notary.serverTime()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "503")
+
+	status = http.StatusOK
+	now, err := notary.serverTime()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), now, time.Minute)
+}
+
+func TestNotaryTimeRequiresNotary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notarytime")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	notaryDir, mirrorDir := setupFileRepo(t, dir)
+	settings := &Settings{
+		LocalRepoPath: dir,
+		NotaryURL:     fileURL(notaryDir),
+		MirrorURL:     fileURL(mirrorDir),
+		GUN:           testGUN,
+	}
+	_, err = NewClient(settings, WithFileURLs(), WithNotaryTime(), loadOnStart(false))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "notary time")
+}
@@ -0,0 +1,115 @@
+package tuf
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// tlsOptions are applied to the transport used for every request to Notary
+// and the mirror.
+type tlsOptions struct {
+	caBundle string
+	certFile string
+	keyFile  string
+	pins     []string
+}
+
+func (o *tlsOptions) empty() bool {
+	return o.caBundle == "" && o.certFile == "" && len(o.pins) == 0
+}
+
+// WithCABundle verifies the certificates of Notary and the mirror using the
+// PEM encoded certificate authorities in caFile instead of the system roots.
+func WithCABundle(caFile string) Option {
+	return func(c *Client) {
+		c.tls.caBundle = caFile
+	}
+}
+
+// WithClientCertificate presents the PEM encoded certificate and private key
+// in certFile and keyFile to servers that require mutual TLS.
+func WithClientCertificate(certFile, keyFile string) Option {
+	return func(c *Client) {
+		c.tls.certFile = certFile
+		c.tls.keyFile = keyFile
+	}
+}
+
+// WithPinnedKeys rejects connections to servers unless a certificate in the
+// verified chain, or the leaf certificate if verification is disabled, has a
+// public key matching one of the pins. A pin
+// is the base64 encoded SHA-256 hash of a DER encoded SubjectPublicKeyInfo,
+// the same format used by HTTP Public Key Pinning. Pinning is in addition to
+// normal certificate verification.
+func WithPinnedKeys(pins ...string) Option {
+	return func(c *Client) {
+		c.tls.pins = append(c.tls.pins, pins...)
+	}
+}
+
+// apply adds the TLS options to config.
+func (o *tlsOptions) apply(config *tls.Config) error {
+	if o.caBundle != "" {
+		buff, err := ioutil.ReadFile(o.caBundle)
+		if err != nil {
+			return errors.Wrap(err, "reading ca bundle")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buff) {
+			return errors.Errorf("no certificates found in %q", o.caBundle)
+		}
+		config.RootCAs = pool
+	}
+	if o.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return errors.Wrap(err, "loading client certificate")
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+	if len(o.pins) > 0 {
+		pins := make(map[string]bool)
+		for _, pin := range o.pins {
+			hash, err := base64.StdEncoding.DecodeString(pin)
+			if err != nil || len(hash) != sha256.Size {
+				return errors.Errorf("invalid public key pin %q", pin)
+			}
+			pins[string(hash)] = true
+		}
+		// VerifyConnection is called for resumed sessions as well as full
+		// handshakes.
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyPins(pins, state)
+		}
+	}
+	return nil
+}
+
+// errPinMismatch is returned when none of the certificates the server was
+// verified with match a pinned public key.
+var errPinMismatch = errors.New("server public key does not match any pinned key")
+
+// verifyPins only considers certificates in the verified chains, because a
+// server can send any extra certificates it likes. When chain verification
+// is disabled only the leaf certificate is considered.
+func verifyPins(pins map[string]bool, state tls.ConnectionState) error {
+	var certs []*x509.Certificate
+	for _, chain := range state.VerifiedChains {
+		certs = append(certs, chain...)
+	}
+	if len(state.VerifiedChains) == 0 && len(state.PeerCertificates) > 0 {
+		certs = state.PeerCertificates[:1]
+	}
+	for _, cert := range certs {
+		hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		if pins[string(hash[:])] {
+			return nil
+		}
+	}
+	return errPinMismatch
+}
@@ -0,0 +1,167 @@
+package tuf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serverCertificate returns the leaf certificate presented by the server at
+// serverURL.
+func serverCertificate(t *testing.T, serverURL string) *x509.Certificate {
+	u, err := url.Parse(serverURL)
+	require.NoError(t, err)
+	conn, err := tls.Dial("tcp", u.Host, &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0]
+}
+
+func writePEM(t *testing.T, filename, blockType string, der []byte) {
+	buff := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, ioutil.WriteFile(filename, buff, 0600))
+}
+
+func spkiPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func TestCABundleAndPinning(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	k := clock.NewMockClock(testTime)
+	settings, _, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cert := serverCertificate(t, settings.NotaryURL)
+	caFile := filepath.Join(dir, "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", cert.Raw)
+
+	// the test servers aren't trusted by the system roots
+	_, err = NewClient(settings, withClock(k))
+	require.Error(t, err)
+
+	for _, opts := range [][]Option{
+		{WithCABundle(caFile)},
+		{WithCABundle(caFile), WithPinnedKeys(spkiPin(cert))},
+		{WithHTTPClient(testHTTPClient()), WithPinnedKeys("bm90IHRoZSByaWdodCBrZXkgYXQgYWxsLCBub3QgYXQ=", spkiPin(cert))},
+	} {
+		client, err := NewClient(settings, append(opts, withClock(k))...)
+		require.NoError(t, err)
+		_, _, err = client.Update()
+		require.NoError(t, err)
+		require.NoError(t, client.Download("edge/target", ioutil.Discard))
+		client.Stop()
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherSPKI, err := x509.MarshalPKIXPublicKey(&otherKey.PublicKey)
+	require.NoError(t, err)
+	otherPin := sha256.Sum256(otherSPKI)
+	_, err = NewClient(settings, withClock(k), WithCABundle(caFile), WithPinnedKeys(base64.StdEncoding.EncodeToString(otherPin[:])))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), errPinMismatch.Error())
+
+	_, err = NewClient(settings, withClock(k), WithPinnedKeys("not a pin"))
+	require.Error(t, err)
+	_, err = NewClient(settings, withClock(k), WithCABundle(filepath.Join(dir, "missing.pem")))
+	require.Error(t, err)
+}
+
+func TestPinsOnlyMatchVerifiedCertificates(t *testing.T) {
+	leaf := &x509.Certificate{RawSubjectPublicKeyInfo: []byte("leaf")}
+	ca := &x509.Certificate{RawSubjectPublicKeyInfo: []byte("ca")}
+	pinned := &x509.Certificate{RawSubjectPublicKeyInfo: []byte("pinned")}
+	hash := sha256.Sum256(pinned.RawSubjectPublicKeyInfo)
+	pins := map[string]bool{string(hash[:]): true}
+
+	// an unpinned chain carrying the pinned certificate as an extra certificate
+	state := tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{leaf, pinned},
+		VerifiedChains:   [][]*x509.Certificate{{leaf, ca}},
+	}
+	assert.Equal(t, errPinMismatch, verifyPins(pins, state))
+	state.VerifiedChains = [][]*x509.Certificate{{leaf, pinned}}
+	assert.NoError(t, verifyPins(pins, state))
+
+	// without chain verification only the leaf is considered
+	state = tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, pinned}}
+	assert.Equal(t, errPinMismatch, verifyPins(pins, state))
+	state.PeerCertificates = []*x509.Certificate{pinned, leaf}
+	assert.NoError(t, verifyPins(pins, state))
+}
+
+func TestClientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "updater"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	clientCert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	certFile := filepath.Join(dir, "client.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	keyFile := filepath.Join(dir, "client.key")
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+
+	svr := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(clientCert)
+	svr.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	svr.StartTLS()
+	defer svr.Close()
+	caFile := filepath.Join(dir, "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", svr.Certificate().Raw)
+
+	c := &Client{client: defaultHttpClient()}
+	WithCABundle(caFile)(c)
+	require.NoError(t, c.configureTransport())
+	_, err = c.client.Get(svr.URL)
+	require.Error(t, err)
+
+	c = &Client{client: defaultHttpClient()}
+	WithCABundle(caFile)(c)
+	WithClientCertificate(certFile, keyFile)(c)
+	require.NoError(t, c.configureTransport())
+	resp, err := c.client.Get(svr.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -1,13 +1,13 @@
 package tuf
 
 import (
+	"context"
 	"io"
-	"net/http"
-	"net/url"
-	"path"
 	"time"
 
 	"github.com/WatchBeam/clock"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
 )
 
@@ -17,6 +17,7 @@ var (
 	errUnsupportedHash        = errors.New("unsupported hash alogorithm")
 	errHashIncorrect          = errors.New("file hash does not match")
 	errLengthIncorrect        = errors.New("file length incorrect")
+	errVersionIncorrect       = errors.New("role version does not match parent metadata")
 	errNoSuchTarget           = errors.New("no such target")
 	errNotFound               = errors.New("resource does not exist")
 	errMaxDelegationsExceeded = errors.New("too many delegations")
@@ -32,16 +33,19 @@ type Settings struct {
 	LocalRepoPath string
 	// NotaryURL is the base URL of the notary server where we get new
 	// keys and update information.  i.e. https://notary.kolide.co. Must use
-	// https scheme.
+	// https scheme, unless file URLs are allowed with WithFileURLs.
 	NotaryURL string
 	// MirrorURL is the base URL where distribution packages are found and
-	// downloaded. Must use https scheme.
+	// downloaded. Must use https scheme, unless file URLs are allowed with
+	// WithFileURLs.
 	MirrorURL string
 	// GUN Globally Unique Identifier, an ID used by Notary to identify
 	// a repository. Typically in the form organization/reponame/platform
 	GUN string
 }
 
+// verify checks settings that are needed regardless of where updates come
+// from. URLs are checked when the remote repository and mirror are created.
 func (s *Settings) verify() error {
 	err := validatePath(s.LocalRepoPath)
 	if err != nil {
@@ -50,14 +54,6 @@ func (s *Settings) verify() error {
 	if s.GUN == "" {
 		return errors.New("GUN can't be empty")
 	}
-	_, err = validateURL(s.NotaryURL)
-	if err != nil {
-		return errors.Wrap(err, "remote repo url validation")
-	}
-	_, err = validateURL(s.MirrorURL)
-	if err != nil {
-		return errors.Wrap(err, "mirror url validation")
-	}
 	return nil
 }
 
@@ -69,9 +65,21 @@ type repoMan struct {
 	timestamp *Timestamp
 	snapshot  *Snapshot
 	targets   *RootTarget
-	client    *http.Client
+	mirror    mirror
 	clock     clock.Clock
 	backupAge time.Duration
+	// bandwidthLimit is the maximum rate targets are downloaded at in bytes
+	// per second, zero if unlimited.
+	bandwidthLimit int64
+	progress       ProgressHandler
+	cache          *targetCache
+	decompressors  map[string]Decompressor
+	targetLimits   retrievalLimits
+	sizeLimits     SizeLimits
+	// trustedClock is synced before each refresh, it is nil unless a time
+	// source is configured.
+	trustedClock *trustedClock
+	logger       log.Logger
 }
 
 func (rs *repoMan) save() error {
@@ -79,6 +87,7 @@ func (rs *repoMan) save() error {
 	ss := saveSettings{
 		tufRepositoryRootDir: rs.settings.LocalRepoPath,
 		backupAge:            rs.backupAge,
+		clock:                rs.clock,
 		rootRole:             rs.root,
 		timestampRole:        rs.timestamp,
 		snapshotRole:         rs.snapshot,
@@ -96,6 +105,11 @@ type refreshResponse struct {
 }
 
 func (rs *repoMan) refresh() (bool, error) {
+	if rs.trustedClock != nil {
+		if err := rs.trustedClock.sync(); err != nil {
+			return false, err
+		}
+	}
 	root, err := rs.refreshRoot()
 	if err != nil {
 		return false, errors.Wrap(err, "refreshing root")
@@ -122,14 +136,18 @@ func (rs *repoMan) refresh() (bool, error) {
 	return len(changed) == 0, nil
 }
 
-func newRepoMan(repo persistentRepo, notary remoteRepo, settings *Settings, client *http.Client, backupAge time.Duration, k clock.Clock) *repoMan {
+func newRepoMan(repo persistentRepo, notary remoteRepo, mirror mirror, settings *Settings, backupAge time.Duration, k clock.Clock) *repoMan {
 	man := &repoMan{
 		settings:  settings,
 		repo:      repo,
 		notary:    notary,
-		client:    client,
+		mirror:    mirror,
 		clock:     k,
 		backupAge: backupAge,
+
+		decompressors: defaultDecompressors(),
+		sizeLimits:    defaultSizeLimits,
+		logger:        log.NewNopLogger(),
 	}
 	return man
 }
@@ -202,7 +220,7 @@ func (rs *repoMan) refreshRoot() (*Root, error) {
 	}
 	// 	1.8. **Check for a freeze attack.** The latest known time should be lower
 	// than the expiration timestamp in the current root metadata file.
-	if time.Now().After(root.Signed.Expires) {
+	if rs.clock.Now().After(root.Signed.Expires) {
 		return nil, errFreezeAttack
 	}
 	// Note for section 5.1.1.9 we always replace the target/snapshot roles
@@ -287,6 +305,9 @@ func (rs *repoMan) refreshSnapshot(root *Root, timestamp *Timestamp) (*Snapshot,
 	if err != nil {
 		return nil, errors.Wrap(err, "signature validation failed for snapshot")
 	}
+	if fim.Version > 0 && fim.Version != current.Signed.Version {
+		return nil, errors.Wrap(errVersionIncorrect, "checking snapshot against timestamp")
+	}
 	previous, err := rs.repo.snapshot()
 	if err != nil {
 		return nil, errors.Wrap(err, "fetching local snapshot")
@@ -302,18 +323,19 @@ func (rs *repoMan) refreshSnapshot(root *Root, timestamp *Timestamp) (*Snapshot,
 	// metadata file. Furthermore, any targets metadata filename that was listed
 	// in the trusted snapshot metadata file, if any, MUST continue to be listed
 	// in the new snapshot metadata file.
-	trustedTargets, err := rs.repo.targets(&localTargetFetcher{rs.repo.baseDir()})
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching trusted targets from snapshot")
-	}
-
-	if trustedTargets.Signed.Version > current.Signed.Version {
-		return nil, errRollbackAttack
-	}
-
-	for role, target := range trustedTargets.targetLookup {
-		if target.Signed.Version > current.Signed.Version {
-			return nil, errors.Wrapf(errRollbackAttack, "role %s", role)
+	//
+	// Notary doesn't list versions, in which case the version of each
+	// targets role is compared to the trusted role when it is fetched.
+	for name, trusted := range previous.Signed.Meta {
+		if name == roleRoot {
+			continue
+		}
+		meta, ok := current.Signed.Meta[name]
+		if !ok {
+			return nil, errors.Wrapf(errRollbackAttack, "role %s is no longer listed", name)
+		}
+		if meta.Version > 0 && trusted.Version > meta.Version {
+			return nil, errors.Wrapf(errRollbackAttack, "role %s", name)
 		}
 	}
 
@@ -352,10 +374,8 @@ func (rs *repoMan) refreshTargets(root *Root, snapshot *Snapshot) (*RootTarget,
 	// download a child target while doing a preorder depth first traversal.
 	// TUF validations occur each time a target is read. See targetFetcher.
 	settings := &notaryTargetFetcherSettings{
-		gun:             rs.settings.GUN,
-		url:             rs.settings.NotaryURL,
-		maxResponseSize: defaultMaxResponseSize,
-		client:          rs.client,
+		remote:          rs.notary,
+		maxResponseSize: rs.sizeLimits.Targets,
 		rootRole:        root,
 		snapshotRole:    snapshot,
 		localRootTarget: previous,
@@ -426,38 +446,109 @@ func (rs *repoMan) downloadTarget(target string, destination io.Writer) error {
 	if !ok {
 		return errors.Errorf("unknown target %q", target)
 	}
-	// we expect our mirrored distribution targets to be located
-	// at https://mirror.com/gun/targetname
-	mirrorURL, err := url.Parse(rs.settings.MirrorURL)
-	if err != nil {
-		return errors.Wrap(err, "parse mirror url for download")
+	if rs.cache == nil {
+		return rs.fetchTarget(target, fim, destination)
 	}
-	mirrorURL.Path = path.Join(mirrorURL.Path, rs.settings.GUN, string(target))
-
-	request, err := http.NewRequest(http.MethodGet, mirrorURL.String(), nil)
+	if ok, err := rs.cache.copyTo(fim, destination); ok {
+		return err
+	}
+	entry, err := rs.cache.create()
 	if err != nil {
-		return errors.Wrap(err, "creating target request")
+		// The cache is only an optimization, so download without it.
+		return rs.fetchTarget(target, fim, destination)
+	}
+	if err := rs.fetchTarget(target, fim, io.MultiWriter(destination, entry)); err != nil {
+		entry.abort()
+		return err
+	}
+	// The target has been verified, so failing to cache it doesn't fail the
+	// download.
+	if err := entry.commit(fim); err != nil {
+		level.Info(rs.logger).Log(
+			"msg", "target not cached",
+			"target", target,
+			"err", err,
+		)
+		return nil
+	}
+	if err := rs.cache.evict(); err != nil {
+		level.Info(rs.logger).Log(
+			"msg", "evicting cached targets",
+			"err", err,
+		)
 	}
-	// Dissallow caching because if we are making this call, we know that the target
-	// has changed and we want to make sure we get the data from the mirror, not
-	// from cache.
-	request.Header.Add(cacheControl, cachePolicyNoStore)
-	resp, err := rs.client.Do(request)
+	return nil
+}
+
+// fetchTarget downloads a target from the mirror, writing it to destination
+// as it is verified.
+func (rs *repoMan) fetchTarget(target string, fim FileIntegrityMeta, destination io.Writer) error {
+	if body, info, decompress := rs.openCompressed(target, fim); body != nil {
+		defer body.Close()
+		return rs.fetchCompressed(target, fim, info, decompress, body, destination)
+	}
+	body, err := rs.openTarget(target)
 	if err != nil {
 		return errors.Wrap(err, "fetching target from mirror")
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return errors.Errorf("get target returned %q", resp.Status)
+	var stream io.Reader = io.LimitReader(body, fim.Length)
+	if rs.bandwidthLimit > 0 {
+		stream = newRateLimitedReader(stream, rs.bandwidthLimit, rs.clock)
+	}
+	if rs.progress != nil {
+		stream = newProgressReader(stream, target, fim.Length, rs.progress, rs.clock)
 	}
-	stream := io.LimitReader(resp.Body, fim.Length)
 	if err := fim.verify(io.TeeReader(stream, destination)); err != nil {
 		return errors.Wrap(err, "verifying current target download")
 	}
 	return nil
 }
 
+// openTarget opens a file on the mirror. The request is canceled if it
+// exceeds the limits for target downloads, including while waiting for the
+// mirror to respond.
+func (rs *repoMan) openTarget(name string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := startWatchdog(rs.targetLimits, cancel)
+	body, err := rs.mirror.open(ctx, name)
+	if err != nil {
+		w.stop()
+		cancel()
+		return nil, w.err(err)
+	}
+	return &cancelingBody{ReadCloser: w.watch(body), cancel: cancel}, nil
+}
+
+// trustedTarget returns the file integrity information for a target from
+// the most recent update, or from the local repository if there hasn't been
+// an update.
+func (rs *repoMan) trustedTarget(target string) (FileIntegrityMeta, error) {
+	targets, err := rs.trustedTargets()
+	if err != nil {
+		return FileIntegrityMeta{}, err
+	}
+	fim, ok := targets.paths[target]
+	if !ok {
+		return FileIntegrityMeta{}, errors.Errorf("unknown target %q", target)
+	}
+	return fim, nil
+}
+
+// trustedTargets returns the targets from the last refresh, or from the local
+// repository if there hasn't been one.
+func (rs *repoMan) trustedTargets() (*RootTarget, error) {
+	if rs.targets != nil {
+		return rs.targets, nil
+	}
+	local, err := rs.repo.targets(&localTargetFetcher{rs.repo.baseDir()})
+	if err != nil {
+		return nil, errors.Wrap(err, "reading local targets")
+	}
+	return local, nil
+}
+
 func verifySignatures(role marshaller, keys map[keyID]Key, sigs []Signature, threshold int) error {
 	// just in case, make sure threshold is not zero as this would mean we're not checking any sigs
 	if threshold <= 0 {
@@ -27,21 +27,21 @@ func TestURLValidation(t *testing.T) {
 	}
 
 	hclient := testHTTPClient()
-	r, err := newNotaryRepo(settings, defaultMaxResponseSize, hclient)
+	r, err := newNotaryRepo(settings, defaultSizeLimits, hclient)
 	require.Nil(t, err)
 	assert.NotNil(t, r)
 	assert.NotNil(t, r.url)
 	assert.Equal(t, "kolide/agent/linux", r.gun)
 	settings.NotaryURL = "HtTps://foo.com/zip.json"
-	r, err = newNotaryRepo(settings, defaultMaxResponseSize, hclient)
+	r, err = newNotaryRepo(settings, defaultSizeLimits, hclient)
 	require.Nil(t, err)
 	assert.NotNil(t, r)
 	settings.NotaryURL = "http://foo.com/zip.json"
-	r, err = newNotaryRepo(settings, defaultMaxResponseSize, hclient)
+	r, err = newNotaryRepo(settings, defaultSizeLimits, hclient)
 	require.NotNil(t, err)
 	assert.Nil(t, r)
 	settings.NotaryURL = "garbage"
-	r, err = newNotaryRepo(settings, defaultMaxResponseSize, hclient)
+	r, err = newNotaryRepo(settings, defaultSizeLimits, hclient)
 	require.NotNil(t, err)
 	assert.Nil(t, r)
 }
@@ -0,0 +1,136 @@
+package tuftest
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Fault replaces the normal response to a request. body is what would have
+// been served, or nil if the role or target doesn't exist.
+type Fault func(w http.ResponseWriter, r *http.Request, body []byte)
+
+func roleFaultKey(role string) string     { return "role:" + role }
+func targetFaultKey(target string) string { return "target:" + target }
+
+// SetRoleFault serves role using fault until the faults are cleared. Versioned
+// roots are named "<version>.root".
+func (s *Server) SetRoleFault(role string, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[roleFaultKey(role)] = fault
+}
+
+// SetTargetFault serves target from the mirror using fault until the faults
+// are cleared.
+func (s *Server) SetTargetFault(target string, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[targetFaultKey(target)] = fault
+}
+
+// ClearFaults restores normal responses for every role and target.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = make(map[string]Fault)
+}
+
+// ServeVersion serves a previously published version of role in place of the
+// current one, as an attacker replaying old metadata would.
+func (s *Server) ServeVersion(role string, version int) error {
+	old, ok := s.RoleVersion(role, version)
+	if !ok {
+		return errors.Errorf("version %d of %q was never published", version, role)
+	}
+	s.SetRoleFault(role, ReplaceFault(old))
+	return nil
+}
+
+// StatusFault responds with an HTTP error status.
+func StatusFault(code int) Fault {
+	return func(w http.ResponseWriter, r *http.Request, body []byte) {
+		http.Error(w, http.StatusText(code), code)
+	}
+}
+
+// ReplaceFault serves replacement instead of the real content.
+func ReplaceFault(replacement []byte) Fault {
+	return func(w http.ResponseWriter, r *http.Request, body []byte) {
+		w.Write(replacement)
+	}
+}
+
+// CorruptFault flips a bit in the middle of the content.
+func CorruptFault() Fault {
+	return func(w http.ResponseWriter, r *http.Request, body []byte) {
+		corrupt := append([]byte(nil), body...)
+		if len(corrupt) > 0 {
+			corrupt[len(corrupt)/2] ^= 0x01
+		}
+		w.Write(corrupt)
+	}
+}
+
+// TruncateFault serves only the first n bytes of the content.
+func TruncateFault(n int) Fault {
+	return func(w http.ResponseWriter, r *http.Request, body []byte) {
+		if n < len(body) {
+			body = body[:n]
+		}
+		w.Write(body)
+	}
+}
+
+// PadFault serves the content followed by n spaces. Padded metadata still
+// decodes, so only size limits will reject it.
+func PadFault(n int) Fault {
+	return func(w http.ResponseWriter, r *http.Request, body []byte) {
+		w.Write(body)
+		w.Write(bytes.Repeat([]byte(" "), n))
+	}
+}
+
+// DelayFault waits for delay, or until the client goes away, before serving
+// the content.
+func DelayFault(delay time.Duration) Fault {
+	return func(w http.ResponseWriter, r *http.Request, body []byte) {
+		select {
+		case <-time.After(delay):
+			w.Write(body)
+		case <-r.Context().Done():
+		}
+	}
+}
+
+// SlowFault serves the content at about bytesPerSecond, flushing each chunk,
+// until it is done or the client goes away.
+func SlowFault(bytesPerSecond int) Fault {
+	return func(w http.ResponseWriter, r *http.Request, body []byte) {
+		chunk := bytesPerSecond / 10
+		if chunk < 1 {
+			chunk = 1
+		}
+		flusher, _ := w.(http.Flusher)
+		for len(body) > 0 {
+			n := chunk
+			if n > len(body) {
+				n = len(body)
+			}
+			if _, err := w.Write(body[:n]); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			body = body[n:]
+			select {
+			case <-time.After(100 * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
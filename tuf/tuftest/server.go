@@ -0,0 +1,299 @@
+// Package tuftest provides an in-memory Notary server and mirror for testing
+// the tuf package, and for serving small repositories without Notary.
+package tuftest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kolide/updater/tuf/authoring"
+	"github.com/pkg/errors"
+)
+
+const (
+	healthPath   = "/_notary_server/health"
+	mirrorPrefix = "/mirror/"
+	// DefaultExpiry is how far in the future the roles of a new Server expire.
+	DefaultExpiry = 365 * 24 * time.Hour
+)
+
+// Keys are the signers for the top level roles.
+type Keys struct {
+	Root      *authoring.Signer
+	Targets   *authoring.Signer
+	Snapshot  *authoring.Signer
+	Timestamp *authoring.Signer
+}
+
+// Server serves a TUF repository using Notary's URL layout, and a mirror
+// holding the targets, over TLS. Use Client for an http.Client that trusts
+// the server's certificate. The repository can be changed while the server is
+// running, and faults can be injected into any response.
+type Server struct {
+	GUN  string
+	Keys Keys
+
+	server *httptest.Server
+
+	mu       sync.Mutex
+	repo     *authoring.Repo
+	files    authoring.Files
+	versions map[string]map[int][]byte
+	targets  map[string][]byte
+	faults   map[string]Fault
+	requests []string
+}
+
+// NewServer starts a server for gun with a newly generated key for each top
+// level role. The repository is published with no targets, and each role
+// expires after DefaultExpiry.
+func NewServer(gun string) (*Server, error) {
+	var signers []*authoring.Signer
+	for i := 0; i < 4; i++ {
+		signer, err := authoring.GenerateSigner()
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+	now := time.Now()
+	root, err := signers[0].WithCertificate(gun, now, now.Add(DefaultExpiry))
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		GUN:      gun,
+		Keys:     Keys{Root: root, Targets: signers[1], Snapshot: signers[2], Timestamp: signers[3]},
+		repo:     authoring.NewRepo(now.Add(DefaultExpiry), root, signers[1], signers[2], signers[3]),
+		versions: make(map[string]map[int][]byte),
+		targets:  make(map[string][]byte),
+		faults:   make(map[string]Fault),
+	}
+	if err := s.publish(); err != nil {
+		return nil, err
+	}
+	s.server = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	return s, nil
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// NotaryURL is the URL to use as the Notary server.
+func (s *Server) NotaryURL() string {
+	return s.server.URL
+}
+
+// MirrorURL is the URL to use as the mirror.
+func (s *Server) MirrorURL() string {
+	return s.server.URL + strings.TrimSuffix(mirrorPrefix, "/")
+}
+
+// Client returns an HTTP client that trusts the server's certificate.
+func (s *Server) Client() *http.Client {
+	return s.server.Client()
+}
+
+// Update calls fn with the repository and publishes any changes it makes.
+func (s *Server) Update(fn func(repo *authoring.Repo) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := fn(s.repo); err != nil {
+		return err
+	}
+	return s.publish()
+}
+
+// PublishTarget adds content to role as name, places it on the mirror and
+// publishes the repository.
+func (s *Server) PublishTarget(role, name string, content []byte) error {
+	return s.Update(func(repo *authoring.Repo) error {
+		if err := repo.AddTarget(role, name, content); err != nil {
+			return err
+		}
+		s.targets[name] = append([]byte(nil), content...)
+		return nil
+	})
+}
+
+// SetMirrorContent replaces what the mirror serves for a target without
+// changing any metadata.
+func (s *Server) SetMirrorContent(name string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.targets[name] = append([]byte(nil), content...)
+}
+
+// RotateKeys replaces the key trusted for a top level role with a newly
+// generated one, publishes the repository and returns the new key. Rotating
+// the root key produces a root signed by both the old and the new key.
+func (s *Server) RotateKeys(role string) (*authoring.Signer, error) {
+	signer, err := authoring.GenerateSigner()
+	if err != nil {
+		return nil, err
+	}
+	err = s.Update(func(repo *authoring.Repo) error {
+		return repo.SetKeys(role, 1, signer)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch role {
+	case authoring.RoleRoot:
+		s.Keys.Root = signer
+	case authoring.RoleTargets:
+		s.Keys.Targets = signer
+	case authoring.RoleSnapshot:
+		s.Keys.Snapshot = signer
+	case authoring.RoleTimestamp:
+		s.Keys.Timestamp = signer
+	}
+	return signer, nil
+}
+
+// SetExpires changes when a role expires and publishes the repository.
+// Passing a time in the past serves an expired role.
+func (s *Server) SetExpires(role string, expires time.Time) error {
+	return s.Update(func(repo *authoring.Repo) error {
+		switch role {
+		case authoring.RoleRoot:
+			repo.Root.Signed.Expires = expires
+		case authoring.RoleTargets:
+			repo.Targets.Signed.Expires = expires
+		case authoring.RoleSnapshot:
+			repo.Snapshot.Signed.Expires = expires
+		case authoring.RoleTimestamp:
+			repo.Timestamp.Signed.Expires = expires
+		default:
+			delegated, ok := repo.Delegated[role]
+			if !ok {
+				return errors.Errorf("unknown role %q", role)
+			}
+			delegated.Signed.Expires = expires
+		}
+		return nil
+	})
+}
+
+// Role returns the currently published JSON for a role.
+func (s *Server) Role(role string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buff, ok := s.files[role]
+	return buff, ok
+}
+
+// RoleVersion returns a previously published version of a role.
+func (s *Server) RoleVersion(role string, version int) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buff, ok := s.versions[role][version]
+	return buff, ok
+}
+
+// RootDigest returns the hex encoded SHA-256 digest of the current root, for
+// bootstrapping a client.
+func (s *Server) RootDigest() string {
+	root, _ := s.Role(authoring.RoleRoot)
+	sum := sha256.Sum256(root)
+	return hex.EncodeToString(sum[:])
+}
+
+// WriteLocalRepo writes the current roles to dir, as they would be shipped
+// with an application.
+func (s *Server) WriteLocalRepo(dir string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := make(authoring.Files)
+	for name, buff := range s.files {
+		if isVersionedRoot(name) {
+			continue
+		}
+		files[name] = buff
+	}
+	return files.Write(dir)
+}
+
+// Requests returns the paths requested from the server, in order.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) publish() error {
+	files, err := s.repo.Publish()
+	if err != nil {
+		return errors.Wrap(err, "publishing repository")
+	}
+	for name, buff := range files {
+		var header struct {
+			Signed struct {
+				Version int `json:"version"`
+			} `json:"signed"`
+		}
+		if err := json.Unmarshal(buff, &header); err != nil {
+			return errors.Wrapf(err, "decoding published %q", name)
+		}
+		if s.versions[name] == nil {
+			s.versions[name] = make(map[int][]byte)
+		}
+		s.versions[name][header.Signed.Version] = buff
+	}
+	s.files = files
+	return nil
+}
+
+func isVersionedRoot(name string) bool {
+	i := strings.Index(name, ".")
+	return i > 0 && name[i+1:] == authoring.RoleRoot
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.URL.Path)
+	body, fault, ok := s.lookup(r.URL.Path)
+	s.mu.Unlock()
+
+	if r.URL.Path == healthPath {
+		w.Write([]byte("{}"))
+		return
+	}
+	if fault != nil {
+		fault(w, r, body)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(body)
+}
+
+// lookup finds the content and any fault for a request path. Roles are keyed
+// by role name and targets by target name.
+func (s *Server) lookup(path string) ([]byte, Fault, bool) {
+	rolePrefix := "/v2/" + s.GUN + "/_trust/tuf/"
+	targetPrefix := mirrorPrefix + s.GUN + "/"
+	switch {
+	case strings.HasPrefix(path, rolePrefix) && strings.HasSuffix(path, ".json"):
+		name := strings.TrimSuffix(strings.TrimPrefix(path, rolePrefix), ".json")
+		body, ok := s.files[name]
+		return body, s.faults[roleFaultKey(name)], ok
+	case strings.HasPrefix(path, targetPrefix):
+		name := strings.TrimPrefix(path, targetPrefix)
+		body, ok := s.targets[name]
+		return body, s.faults[targetFaultKey(name)], ok
+	}
+	return nil, nil, false
+}
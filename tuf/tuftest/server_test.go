@@ -0,0 +1,87 @@
+package tuftest_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kolide/updater/tuf"
+	"github.com/kolide/updater/tuf/authoring"
+	"github.com/kolide/updater/tuf/tuftest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testGUN = "kolide/tuftest/test"
+
+func newClient(t *testing.T, server *tuftest.Server) (*tuf.Client, func()) {
+	dir, err := ioutil.TempDir("", "tuftest")
+	require.NoError(t, err)
+	require.NoError(t, server.WriteLocalRepo(dir))
+	settings := &tuf.Settings{
+		LocalRepoPath: dir,
+		NotaryURL:     server.NotaryURL(),
+		MirrorURL:     server.MirrorURL(),
+		GUN:           server.GUN,
+	}
+	client, err := tuf.NewClient(settings, tuf.WithHTTPClient(server.Client()))
+	require.NoError(t, err)
+	return client, func() {
+		client.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestServerUpdates(t *testing.T) {
+	server, err := tuftest.NewServer(testGUN)
+	require.NoError(t, err)
+	defer server.Close()
+	client, cleanup := newClient(t, server)
+	defer cleanup()
+
+	v1 := []byte("version one")
+	require.NoError(t, server.PublishTarget(authoring.RoleTargets, "edge/target", v1))
+	_, err = server.RotateKeys(authoring.RoleRoot)
+	require.NoError(t, err)
+	_, err = server.RotateKeys(authoring.RoleTimestamp)
+	require.NoError(t, err)
+
+	files, latest, err := client.Update()
+	require.NoError(t, err)
+	assert.False(t, latest)
+	assert.Contains(t, files, "edge/target")
+	var buff bytes.Buffer
+	require.NoError(t, client.Download("edge/target", &buff))
+	assert.Equal(t, v1, buff.Bytes())
+	assert.Contains(t, server.Requests(), "/v2/"+testGUN+"/_trust/tuf/2.root.json")
+}
+
+func TestServerFaults(t *testing.T) {
+	server, err := tuftest.NewServer(testGUN)
+	require.NoError(t, err)
+	defer server.Close()
+	require.NoError(t, server.PublishTarget(authoring.RoleTargets, "edge/target", []byte("version one")))
+	client, cleanup := newClient(t, server)
+	defer cleanup()
+
+	_, _, err = client.Update()
+	require.NoError(t, err)
+	server.SetTargetFault("edge/target", tuftest.CorruptFault())
+	assert.Error(t, client.Download("edge/target", ioutil.Discard))
+	server.SetRoleFault(authoring.RoleTimestamp, tuftest.StatusFault(http.StatusServiceUnavailable))
+	_, _, err = client.Update()
+	assert.Error(t, err)
+
+	server.ClearFaults()
+	require.NoError(t, server.SetExpires(authoring.RoleTimestamp, time.Now().Add(-time.Hour)))
+	_, _, err = client.Update()
+	assert.Error(t, err)
+
+	require.NoError(t, server.SetExpires(authoring.RoleTimestamp, time.Now().Add(time.Hour)))
+	_, _, err = client.Update()
+	require.NoError(t, err)
+	assert.NoError(t, client.Download("edge/target", ioutil.Discard))
+}
@@ -0,0 +1,71 @@
+package tuf
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// Open downloads a target and returns its contents once they have been
+// verified. Unlike Download, which writes bytes to the destination as they
+// arrive, nothing can be read from the returned stream unless the whole
+// target matched the TUF metadata. The target is buffered in a temporary
+// file which is removed when the stream is closed, so the caller must call
+// Close. Like Download, Open uses local TUF metadata, so Update should be
+// called first.
+func (c *Client) Open(targetName string) (io.ReadCloser, error) {
+	type resultOpen struct {
+		rdr io.ReadCloser
+		err error
+	}
+	resultC := make(chan resultOpen)
+	c.jobs <- func(rm *repoMan) {
+		level.Debug(c.logger).Log(
+			"msg", "TUF opening verified target",
+			"targetName", targetName,
+		)
+		rdr, err := rm.openVerified(targetName)
+		resultC <- resultOpen{rdr, err}
+	}
+	result := <-resultC
+	return result.rdr, result.err
+}
+
+func (rs *repoMan) openVerified(target string) (io.ReadCloser, error) {
+	tmp, err := ioutil.TempFile("", "tuf-target")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating temporary file for target")
+	}
+	vf := &verifiedFile{tmp}
+	if err := rs.downloadTarget(target, tmp); err != nil {
+		vf.Close()
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		vf.Close()
+		return nil, errors.Wrap(err, "rewinding verified target")
+	}
+	return vf, nil
+}
+
+// verifiedFile is a temporary file holding a verified target. Only reading
+// and closing are exposed so that the caller can't modify it.
+type verifiedFile struct {
+	f *os.File
+}
+
+func (vf *verifiedFile) Read(p []byte) (int, error) {
+	return vf.f.Read(p)
+}
+
+// Close closes and removes the temporary file.
+func (vf *verifiedFile) Close() error {
+	err := vf.f.Close()
+	if rerr := os.Remove(vf.f.Name()); rerr != nil && err == nil {
+		err = rerr
+	}
+	return err
+}
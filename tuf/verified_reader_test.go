@@ -0,0 +1,63 @@
+package tuf
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenVerified(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	settings, _, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	client, err := NewClient(settings, WithHTTPClient(testHTTPClient()), withClock(clock.NewMockClock(testTime)))
+	require.NoError(t, err)
+	defer client.Stop()
+	_, _, err = client.Update()
+	require.NoError(t, err)
+
+	rdr, err := client.Open("edge/target")
+	require.NoError(t, err)
+	buff, err := ioutil.ReadAll(rdr)
+	require.NoError(t, err)
+	assert.Equal(t, testAsset(t, path.Join(mirrorRoot, "2", "edge", "target")), buff)
+	tmpName := rdr.(*verifiedFile).f.Name()
+	require.NoError(t, rdr.Close())
+	_, err = os.Stat(tmpName)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = client.Open("missing/target")
+	assert.Error(t, err)
+}
+
+func TestOpenVerifiedCorrupt(t *testing.T) {
+	testTime, _ := time.Parse(time.UnixDate, "Sat Jul 1 18:00:00 CST 2017")
+	settings, _, cleanup := setupEndToEndTest(t, 2, 1)
+	defer cleanup()
+	httpClient := testHTTPClient()
+	httpClient.Transport = corruptingRoundTripper{
+		t:        t,
+		proxied:  httpClient.Transport,
+		targets:  regexp.MustCompile("edge/target$"),
+		breakage: overwriteCorruption,
+	}
+	client, err := NewClient(settings, WithHTTPClient(httpClient), withClock(clock.NewMockClock(testTime)))
+	require.NoError(t, err)
+	defer client.Stop()
+	_, _, err = client.Update()
+	require.NoError(t, err)
+
+	// no stream is returned, so corrupt bytes can't be consumed
+	rdr, err := client.Open("edge/target")
+	require.Error(t, err)
+	assert.Nil(t, rdr)
+	assert.Equal(t, errHashIncorrect, errors.Cause(err))
+}